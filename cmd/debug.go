@@ -77,7 +77,10 @@ func load(args []string) {
 		helper, err = debug.FromScripts("", args, prepareVM)
 	}
 	exitOnError(err, "starting debugger")
-	helper.IgnoreErrs = ignoreErrs
+	if ignoreErrs {
+		helper.ExceptionFilters = debug.DefaultExceptionFilters(true)
+	}
+	helper.ApplyErrorModes()
 
 	debugShell.Println("Loaded and paused programs. Enter 'c' to start execution.")
 }
@@ -88,19 +91,36 @@ func prepareVM(thisVM *vm.VM, inputFileName string) {
 		debugShell.Printf("--Hit Breakpoint at %s:%d--\n", inputFileName, x.CurrentSourceLine())
 		return false
 	})
-	thisVM.SetErrorHandler(func(x *vm.VM, err error) bool {
-		if !helper.IgnoreErrs {
+	thisVM.SetErrorHandler(func(x *vm.VM, err error) {
+		if helper.BreakOnError(err) {
 			debugShell.Printf("--A runtime error occured at %s:%d--\n", inputFileName, x.CurrentSourceLine())
 			debugShell.Println(err)
 			debugShell.Println("--Execution paused--")
-			return false
 		}
-		return true
+	})
+	thisVM.SetLogHandler(func(x *vm.VM, message string) {
+		debugShell.Printf("--Log %s:%d: %s\n", inputFileName, x.CurrentSourceLine(), message)
+	})
+	thisVM.SetWatchpointHandler(func(x *vm.VM, name string, oldValue *vm.Variable, newValue *vm.Variable) bool {
+		idx := helper.ScriptIndexByName(inputFileName)
+		if !strings.HasPrefix(name, ":") && helper.VariableTranslations[idx] != nil {
+			name = helper.VariableTranslations[idx][name]
+		}
+		oldRepr := "<unset>"
+		if oldValue != nil {
+			oldRepr = oldValue.Repr()
+		}
+		debugShell.Printf("--Watchpoint: %s changed from %s to %s at %s:%d--\n", name, oldRepr, newValue.Repr(), inputFileName, x.CurrentSourceLine())
+		return false
 	})
 	thisVM.SetFinishHandler(func(x *vm.VM) {
 		debugShell.Printf("--Program %s finished--\n", inputFileName)
 	})
 	thisVM.SetStepHandler(func(x *vm.VM) {
+		if x.State() == vm.StateSteppingStatement {
+			debugShell.Printf("--Step executed. VM paused at %s:%d:%d--\n", inputFileName, x.CurrentSourceLine(), x.CurrentSourceColoumn())
+			return
+		}
 		debugShell.Printf("--Step executed. VM paused at %s:%d--\n", inputFileName, x.CurrentSourceLine())
 	})
 }
@@ -200,12 +220,49 @@ func init() {
 			helper.Vms[helper.CurrentScript].Step()
 		},
 	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "stepstmt",
+		Aliases: []string{"st"},
+		Help:    "execute the next statement and pause again",
+		Func: func(c *ishell.Context) {
+			if !running {
+				running = true
+				helper.Coordinator.Run()
+			}
+			if helper.Vms[0].State() == vm.StateTerminated {
+				debugShell.Println("Can not step. Programm already terminated.")
+				return
+			}
+			helper.Vms[helper.CurrentScript].StepStatement()
+		},
+	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "back",
+		Aliases: []string{"sb"},
+		Help:    "revert the last executed line of the current script",
+		Func: func(c *ishell.Context) {
+			if helper.CurrentVM().State() != vm.StatePaused {
+				debugShell.Println("The current script is not paused.")
+				return
+			}
+			reverted, err := helper.History.StepBackVM(helper.CurrentVM())
+			if err != nil {
+				debugShell.Println(err.Error() + ".")
+				return
+			}
+			if !reverted {
+				debugShell.Println("Can not step back any further.")
+				return
+			}
+			debugShell.Printf("--Stepped back. VM paused at %s:%d--\n", helper.ScriptNames[helper.CurrentScript], helper.CurrentVM().CurrentSourceLine())
+		},
+	})
 	debugShell.AddCmd(&ishell.Cmd{
 		Name:    "break",
 		Aliases: []string{"b"},
-		Help:    "add breakpoint at line",
+		Help:    "add breakpoint at line. Usage: break <line> [if <condition>] [hits <hitcondition>] [log <message>]. The options must be given in this order",
 		Func: func(c *ishell.Context) {
-			if len(c.Args) != 1 {
+			if len(c.Args) < 1 {
 				debugShell.Println("You must enter a line number for the breakpoint.")
 				return
 			}
@@ -222,10 +279,47 @@ func init() {
 				}
 			}
 
-			helper.Vms[helper.CurrentScript].AddBreakpoint(line)
+			options := parseBreakpointOptions(c.Args[1:])
+			if options[""] != "" {
+				debugShell.Println("Unexpected argument: ", options[""])
+				return
+			}
+			bp, err := helper.CreateBreakpoint(helper.CurrentScript, line, options["if"], options["hits"], options["log"])
+			if err != nil {
+				debugShell.Println(err)
+				return
+			}
+
+			helper.Vms[helper.CurrentScript].AddConditionalBreakpoint(bp)
 			debugShell.Println("--Breakpoint added--")
 		},
 	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "jump",
+		Aliases: []string{"j"},
+		Help:    "continue execution at the given line when resuming",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				debugShell.Println("You must enter a line number to jump to.")
+				return
+			}
+			line, err := strconv.Atoi(c.Args[0])
+			if err != nil {
+				debugShell.Println("Error parsing line-number: ", err)
+				return
+			}
+			if !helper.IsValidJumpTarget(helper.CurrentScript, line) {
+				debugShell.Println("You can not jump to this line")
+				return
+			}
+			err = helper.CurrentVM().JumpToLine(line)
+			if err != nil {
+				debugShell.Println(err)
+				return
+			}
+			debugShell.Printf("--Execution will continue at %s:%d--\n", helper.ScriptNames[helper.CurrentScript], line)
+		},
+	})
 	debugShell.AddCmd(&ishell.Cmd{
 		Name:    "delete",
 		Aliases: []string{"d"},
@@ -244,6 +338,40 @@ func init() {
 			debugShell.Println("--Breakpoint removed--")
 		},
 	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "watch",
+		Aliases: []string{"wa"},
+		Help:    "pause when a variable is written to",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				debugShell.Println("You must enter a variable-name to watch.")
+				return
+			}
+			if strings.HasPrefix(c.Args[0], ":") {
+				helper.Coordinator.AddWatchpoint(c.Args[0])
+			} else {
+				helper.CurrentVM().AddWatchpoint(watchedVarname(c.Args[0]))
+			}
+			debugShell.Println("--Watchpoint added--")
+		},
+	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "unwatch",
+		Aliases: []string{"uw"},
+		Help:    "remove watchpoint from variable",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				debugShell.Println("You must enter a variable-name.")
+				return
+			}
+			if strings.HasPrefix(c.Args[0], ":") {
+				helper.Coordinator.RemoveWatchpoint(c.Args[0])
+			} else {
+				helper.CurrentVM().RemoveWatchpoint(watchedVarname(c.Args[0]))
+			}
+			debugShell.Println("--Watchpoint removed--")
+		},
+	})
 	debugShell.AddCmd(&ishell.Cmd{
 		Name:    "vars",
 		Aliases: []string{"v"},
@@ -267,6 +395,23 @@ func init() {
 			}
 		},
 	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "eval",
+		Aliases: []string{"e"},
+		Help:    "evaluate an expression using the current variables",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) < 1 {
+				debugShell.Println("You must enter an expression to evaluate")
+				return
+			}
+			result, err := helper.Evaluate(helper.CurrentScript, strings.Join(c.Args, " "))
+			if err != nil {
+				debugShell.Println(err)
+				return
+			}
+			debugShell.Println(result.Repr())
+		},
+	})
 	debugShell.AddCmd(&ishell.Cmd{
 		Name:    "set",
 		Aliases: []string{"w"},
@@ -296,12 +441,13 @@ func init() {
 				statestr = "RUNNING"
 			case vm.StatePaused:
 				statestr = "PAUSED"
-			case vm.StateStepping:
+			case vm.StateStepping, vm.StateSteppingStatement:
 				statestr = "STEPPING"
 			case vm.StateTerminated:
 				statestr = "DONE"
 			}
 			debugShell.Printf("--State: %s\n", statestr)
+			debugShell.Printf("--Simulated time: %s\n", helper.Coordinator.Now())
 		},
 	})
 	debugShell.AddCmd(&ishell.Cmd{
@@ -330,6 +476,47 @@ func init() {
 			}
 		},
 	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "snapshot",
+		Aliases: []string{"ss"},
+		Help:    "save the state of all scripts to a file",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				debugShell.Println("You must enter a file-name for the snapshot.")
+				return
+			}
+			err := vm.SaveSnapshot(c.Args[0], helper.Coordinator.Snapshot())
+			if err != nil {
+				debugShell.Println("Error saving snapshot: ", err)
+				return
+			}
+			debugShell.Println("--Snapshot saved--")
+		},
+	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "restore",
+		Aliases: []string{"rs"},
+		Help:    "reset debugger and restore the state saved in a snapshot-file",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				debugShell.Println("You must enter the file-name of the snapshot.")
+				return
+			}
+			snap, err := vm.LoadSnapshot(c.Args[0])
+			if err != nil {
+				debugShell.Println("Error loading snapshot: ", err)
+				return
+			}
+			helper.Coordinator.Terminate()
+			load(cliargs)
+			err = helper.Coordinator.Restore(snap)
+			if err != nil {
+				debugShell.Println("Error restoring snapshot: ", err)
+				return
+			}
+			debugShell.Println("--Snapshot restored--")
+		},
+	})
 	debugShell.AddCmd(&ishell.Cmd{
 		Name:    "disas",
 		Aliases: []string{"d"},
@@ -375,6 +562,50 @@ func sortVariables(vars map[string]vm.Variable) []namedVariable {
 	return sorted
 }
 
+// the keywords of the break-command, in the order they have to be used in
+var breakpointKeywords = []string{"if", "hits", "log"}
+
+// splits the arguments of the break-command into the parts following the keywords if, hits and log.
+// A keyword only starts a new part if it follows the keyword of the current part in the order if, hits, log
+// and the current part is not empty. Otherwise it is part of the condition or message.
+// Everything after log belongs to the message. Arguments before the first keyword are stored under ""
+func parseBreakpointOptions(args []string) map[string]string {
+	options := make(map[string]string)
+	current := ""
+	// the index of the current keyword in breakpointKeywords
+	position := -1
+	for _, arg := range args {
+		if current == "" || options[current] != "" {
+			found := false
+			for i := position + 1; i < len(breakpointKeywords); i++ {
+				if arg == breakpointKeywords[i] {
+					current = arg
+					position = i
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+		}
+		if options[current] != "" {
+			options[current] += " "
+		}
+		options[current] += arg
+	}
+	return options
+}
+
+// returns the name a local variable of the current script has inside the vm
+func watchedVarname(name string) string {
+	translated := helper.ReverseVarnameTranslation(helper.CurrentScript, strings.ToLower(name))
+	if translated == "" {
+		return name
+	}
+	return translated
+}
+
 func contains(arr []int, val int) bool {
 	for _, e := range arr {
 		if e == val {
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBreakpointOptions(t *testing.T) {
+	cases := []struct {
+		args     string
+		expected map[string]string
+	}{
+		{"", map[string]string{}},
+		{"if :a > 1", map[string]string{"if": ":a > 1"}},
+		{"if :a > 1 hits >= 3 log a is :a", map[string]string{"if": ":a > 1", "hits": ">= 3", "log": "a is :a"}},
+		{"hits 2 log reached", map[string]string{"hits": "2", "log": "reached"}},
+		// everything after log belongs to the message
+		{"log stop if hits are high", map[string]string{"log": "stop if hits are high"}},
+		// keywords out of order belong to the current part
+		{"hits 2 if :a", map[string]string{"hits": "2 if :a"}},
+		// a keyword directly following another keyword is not a separator
+		{"if hits > 2 hits 3", map[string]string{"if": "hits > 2", "hits": "3"}},
+		{"if log == 1", map[string]string{"if": "log == 1"}},
+		{"unexpected if :a", map[string]string{"": "unexpected", "if": ":a"}},
+	}
+	for _, c := range cases {
+		options := parseBreakpointOptions(strings.Fields(c.args))
+		if !reflect.DeepEqual(options, c.expected) {
+			t.Errorf("Wrong options for '%s'. Wanted %v but got %v", c.args, c.expected, options)
+		}
+	}
+}
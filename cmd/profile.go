@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/testing"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+var profileTop int
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile [script]+ / profile [testfile]",
+	Short: "Find the most executed lines of yolol/nolol programs",
+	Long:  `Run the given programs (or all cases of the given test) and print how often each line has been executed`,
+	Run: func(cmd *cobra.Command, args []string) {
+		profile := vm.NewProfile()
+		// maps script-names to the files containing the scripts
+		files := make(map[string]string)
+
+		if len(args) == 1 && strings.HasSuffix(args[0], ".yaml") {
+			absolutePath, _ := filepath.Abs(args[0])
+			test, err := testing.Parse([]byte(loadInputFile(args[0])), absolutePath)
+			exitOnError(err, "loading test case")
+			test.Profile = profile
+			test.DetectIdle = test.DetectIdle || detectIdle
+			for _, script := range test.Scripts {
+				files[script] = filepath.Join(filepath.Dir(absolutePath), script)
+			}
+			test.Run(nil)
+		} else {
+			for _, file := range args {
+				files[file] = file
+			}
+			runScripts(args, func(v *vm.VM, file string) {
+				v.SetProfile(profile, file)
+			})
+		}
+
+		printProfile(profile, files)
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+// printProfile prints the hot-lines and goto-loops of the profile
+// files maps the script-names used in the profile to the files containing the scripts
+func printProfile(profile *vm.Profile, files map[string]string) {
+	total := profile.TotalLines()
+	fmt.Printf("Executed lines: %d\n\n", total)
+	if total == 0 {
+		return
+	}
+
+	// nolol-lines are reported using their position in the nolol-source, yolol-lines by their line-number
+	lines := make([]vm.ProfileEntry, 0)
+	for _, entry := range profile.Lines() {
+		if !strings.HasSuffix(entry.Script, ".nolol") {
+			lines = append(lines, entry)
+		}
+	}
+	for _, entry := range profile.SourceLines() {
+		if strings.HasSuffix(entry.Script, ".nolol") {
+			lines = append(lines, entry)
+		}
+	}
+	sortProfileEntries(lines)
+
+	sources := make(map[string][]string)
+	fmt.Println("Hot lines:")
+	fmt.Printf("%10s %7s  %-25s %s\n", "Executions", "%", "Line", "Code")
+	for i, entry := range lines {
+		if profileTop > 0 && i >= profileTop {
+			break
+		}
+		file := files[entry.Script]
+		if entry.Position.File != "" {
+			// lines of included files. The path of the include is relative to the including script
+			if filepath.IsAbs(entry.Position.File) {
+				file = entry.Position.File
+			} else {
+				file = filepath.Join(filepath.Dir(file), entry.Position.File)
+			}
+		}
+		if _, loaded := sources[file]; !loaded {
+			content, _ := ioutil.ReadFile(file)
+			sources[file] = strings.Split(string(content), "\n")
+		}
+		code := ""
+		if entry.Position.Line-1 < len(sources[file]) {
+			code = strings.TrimSpace(sources[file][entry.Position.Line-1])
+		}
+		location := fmt.Sprintf("%s:%d", filepath.Base(file), entry.Position.Line)
+		percent := 100 * float64(entry.Executions) / float64(total)
+		fmt.Printf("%10d %6.2f%%  %-25s %s\n", entry.Executions, percent, location, code)
+	}
+
+	loops := profile.Loops()
+	if len(loops) == 0 {
+		return
+	}
+	fmt.Println("\nGoto loops (lines of the yolol-code):")
+	fmt.Printf("%-25s %10s %10s %15s %15s\n", "Loop", "Taken", "Iterations", "Lines/Iteration", "Time/Iteration")
+	for _, loop := range loops {
+		location := fmt.Sprintf("%s:%d->%d", filepath.Base(files[loop.Script]), loop.From, loop.To)
+		fmt.Printf("%-25s %10d %10d %15.2f %15s\n", location, loop.Taken, loop.Iterations, loop.AverageLines(), loop.AverageTime())
+	}
+}
+
+// sortProfileEntries sorts the entries by their number of executions, the most executed first
+func sortProfileEntries(entries []vm.ProfileEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Executions > entries[j].Executions
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.Flags().IntVar(&profileTop, "top", 20, "Number of lines to show. 0 shows all executed lines")
+	profileCmd.Flags().StringVar(&runFor, "runfor", "", "Amount of simulated time to run the programs for (e.g. 12s)")
+	profileCmd.Flags().IntVar(&maxLines, "lines", 0, "Maximum number of lines each program executes. Defaults to 2000 if --runfor is not set")
+	profileCmd.Flags().BoolVar(&detectIdle, "detect-idle", false, "Stop as soon as the programs do not change any variable anymore and are stuck in a loop")
+	profileCmd.Flags().StringVar(&engineName, "engine", "interpreter", "The engine that executes the programs: interpreter or compiled. The compiled engine is faster for long runs")
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/testing"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+var runFor string
+var maxLines int
+var traceFile string
+var detectIdle bool
+var engineName string
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run [script]+",
+	Short: "Run yolol/nolol programs",
+	Long:  `Run the given programs like chips on the same network and print the global variables afterwards`,
+	Run: func(cmd *cobra.Command, args []string) {
+		trace := createTrace()
+		coord := runScripts(args, func(v *vm.VM, file string) {
+			if trace != nil {
+				v.SetTrace(trace, file)
+			}
+		})
+		fmt.Printf("Finished after %s of simulated time\n", coord.Now())
+		if idle := coord.Idle(); idle != nil {
+			fmt.Println(idle.Error())
+		}
+		for _, variable := range sortVariables(coord.GetVariables()) {
+			fmt.Println(variable.name, variable.val.Repr())
+		}
+		writeTrace(trace)
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+// runScripts runs the given scripts on a coordinator until they terminate (limited by --runfor and --lines)
+// or become idle (if --detect-idle is set).
+// prepare is called for every created vm before the execution starts
+func runScripts(files []string, prepare func(v *vm.VM, file string)) *vm.Coordinator {
+	timeLimit, err := testing.ParseDuration(runFor)
+	exitOnError(err, "parsing --runfor")
+	if maxLines == 0 && timeLimit == 0 {
+		maxLines = 2000
+	}
+
+	engine, err := vm.ParseEngine(engineName)
+	exitOnError(err, "parsing --engine")
+
+	coord := vm.NewCoordinator()
+	coord.SetTimeLimit(timeLimit)
+	if detectIdle {
+		// stop early if the programs do not do anything anymore
+		coord.EnableIdleDetection()
+	}
+	for _, file := range files {
+		v := loadVM(file)
+		err = v.SetEngine(engine)
+		exitOnError(err, "preparing '"+file+"'")
+		v.SetMaxExecutedLines(maxLines)
+		v.SetCoordinator(coord)
+		name := file
+		v.SetErrorHandler(func(x *vm.VM, err error) {
+			fmt.Printf("Runtime error in %s:%d: %s\n", name, x.CurrentSourceLine(), err.Error())
+		})
+		// like in the game, a runtime-error only aborts the current line
+		v.SetErrorMode(vm.ErrorModeAbortLine)
+		prepare(v, file)
+		v.Resume()
+	}
+
+	coord.Run()
+	coord.WaitForTermination()
+	return coord
+}
+
+// loadVM creates a vm for the given yolol or nolol file
+func loadVM(file string) *vm.VM {
+	if strings.HasSuffix(file, ".nolol") {
+		converter := nolol.NewConverter()
+		prog, err := converter.ConvertFile(file)
+		exitOnError(err, "converting '"+file+"' to yolol")
+		return vm.Create(prog)
+	}
+	v, err := vm.CreateFromSource(loadInputFile(file))
+	exitOnError(err, "parsing '"+file+"'")
+	return v
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().StringVar(&runFor, "runfor", "", "Amount of simulated time to run the programs for (e.g. 12s)")
+	runCmd.Flags().IntVar(&maxLines, "lines", 0, "Maximum number of lines each program executes. Defaults to 2000 if --runfor is not set")
+	runCmd.Flags().BoolVar(&detectIdle, "detect-idle", false, "Stop as soon as the programs do not change any variable anymore and are stuck in a loop")
+	runCmd.Flags().StringVar(&engineName, "engine", "interpreter", "The engine that executes the programs: interpreter or compiled. The compiled engine is faster for long runs")
+	runCmd.Flags().StringVar(&traceFile, "trace", "", "Record all executed lines to this file. Files ending in .csv are written as csv, all others as json-lines")
+}
@@ -1,42 +1,237 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/testing"
 	"github.com/spf13/cobra"
 )
 
+var seed int64
+var fuzzRuns int
+var printCoverage bool
+var lcovFile string
+var htmlFile string
+var reportFormat string
+var reportFile string
+var parallel int
+var runPattern string
+
 // testCmd represents the format command
 var testCmd = &cobra.Command{
-	Use:   "test [testfile] [testfile] ...",
+	Use:   "test [testfile|directory|directory/...] ...",
 	Short: "Run tests",
+	Long:  `Run the given test-files. For directories, all test-files (ending in _test.yaml) in the directory are run. Use directory/... to also search all sub-directories`,
 
 	Run: func(cmd *cobra.Command, args []string) {
-		for _, arg := range args {
-			file := loadInputFile(arg)
-			absolutePath, _ := filepath.Abs(arg)
-			test, err := testing.Parse([]byte(file), absolutePath)
-			exitOnError(err, "loading test case")
-			fmt.Println("Running file: " + arg)
-			fails := test.Run(func(c testing.Case) {
-				fmt.Println("- Running case: " + c.Name)
-			})
-			if len(fails) == 0 {
-				fmt.Println("Tests OK")
-			} else {
-				fmt.Println("There were errors when running the tests:")
-				for _, err := range fails {
-					fmt.Println(err)
+		files, err := testing.FindTestFiles(args)
+		exitOnError(err, "searching test-files")
+		var casePattern *regexp.Regexp
+		if runPattern != "" {
+			casePattern, err = regexp.Compile(runPattern)
+			exitOnError(err, "parsing --run")
+		}
+		trace := createTrace()
+		var coverage *testing.Coverage
+		if printCoverage || lcovFile != "" || htmlFile != "" {
+			coverage = testing.NewCoverage()
+		}
+		report := createReport()
+		// keep the report on stdout machine-readable
+		out := io.Writer(os.Stdout)
+		if reportToStdout() {
+			out = os.Stderr
+		}
+		var pool *testing.Pool
+		if parallel > 1 {
+			if trace != nil {
+				exitOnError(fmt.Errorf("--trace can not be used together with --parallel"), "running tests")
+			}
+			pool = testing.NewPool(parallel)
+		}
+		// run runs the given file and writes its output to out. Returns true if the file passed
+		run := func(file string, out io.Writer) bool {
+			absolutePath, _ := filepath.Abs(file)
+			test, err := loadTest(file, absolutePath)
+			if err != nil {
+				report.AddFileError(absolutePath, err)
+				fmt.Fprintf(out, "Error when loading test-file %s:\n\n%s\n", file, err.Error())
+				return false
+			}
+			if casePattern != nil {
+				test.SelectCases(casePattern)
+				if len(test.Cases) == 0 {
+					return true
 				}
-				os.Exit(1)
 			}
+			test.Trace = trace
+			test.Coverage = coverage
+			test.Report = report
+			test.Pool = pool
+			return runTest(cmd, test, file, out)
+		}
+
+		allPassed := true
+		if pool == nil {
+			for _, file := range files {
+				allPassed = run(file, out) && allPassed
+				// rewrite the trace after every file, so it is complete even if the command is aborted
+				writeTrace(trace)
+			}
+		} else {
+			// run all files at the same time (the pool limits the number of running cases),
+			// but print the output of the files in the order of the arguments
+			outputs := make([]*bytes.Buffer, len(files))
+			passed := make([]bool, len(files))
+			done := make([]chan struct{}, len(files))
+			for i, file := range files {
+				outputs[i] = &bytes.Buffer{}
+				done[i] = make(chan struct{})
+				go func(i int, file string) {
+					defer close(done[i])
+					passed[i] = run(file, outputs[i])
+				}(i, file)
+			}
+			for i := range files {
+				<-done[i]
+				out.Write(outputs[i].Bytes())
+				allPassed = passed[i] && allPassed
+			}
+		}
+		reportCoverage(coverage, out)
+		writeReport(report)
+		fmt.Fprintln(out, "Summary:")
+		err = report.WriteSummary(out)
+		exitOnError(err, "printing summary")
+		if !allPassed {
+			os.Exit(1)
 		}
 	},
 }
 
+// loadTest loads and parses the given test-file. absolutePath is the absolute path of the file
+func loadTest(file string, absolutePath string) (testing.Test, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return testing.Test{}, err
+	}
+	return testing.Parse(content, absolutePath)
+}
+
+// runTest runs all cases of the test as requested by the flags and writes the results to out.
+// Returns true if all cases passed
+func runTest(cmd *cobra.Command, test testing.Test, file string, out io.Writer) bool {
+	fmt.Fprintln(out, "Running file: "+file)
+	callback := func(c testing.Case) {
+		fmt.Fprintln(out, "- Running case: "+c.Name)
+	}
+	var fails []error
+	if cmd.Flags().Changed("seed") {
+		fails = test.RunWithSeed(seed, callback)
+	} else if fuzzRuns > 0 {
+		seeds := make([]int64, fuzzRuns)
+		for i := range seeds {
+			seeds[i] = int64(i + 1)
+		}
+		fails = test.Fuzz(seeds, callback)
+	} else {
+		fails = test.Run(callback)
+	}
+	if len(fails) == 0 {
+		fmt.Fprintln(out, "Tests OK")
+		return true
+	}
+	fmt.Fprintln(out, "There were errors when running the tests:")
+	for _, err := range fails {
+		fmt.Fprintln(out, err)
+	}
+	return false
+}
+
+// createReport returns the report that records the results of all cases. It is used for the summary and
+// written to a file if requested by the flags
+func createReport() *testing.Report {
+	if reportFormat == "" && reportFile != "" {
+		exitOnError(fmt.Errorf("--report-file requires --report"), "creating report")
+	}
+	if reportFormat != "" {
+		valid := false
+		for _, format := range testing.ReportFormats {
+			valid = valid || format == reportFormat
+		}
+		if !valid {
+			exitOnError(fmt.Errorf("Unknown report-format '%s'. Available formats are: %s", reportFormat, strings.Join(testing.ReportFormats, ", ")), "creating report")
+		}
+	}
+	wd, _ := os.Getwd()
+	return testing.NewReport(wd)
+}
+
+// reportToStdout returns true if the flags request a report that is written to stdout
+func reportToStdout() bool {
+	return reportFormat != "" && (reportFile == "" || reportFile == "-")
+}
+
+// writeReport writes the report to the file given by the flags (or stdout). Does nothing if no report has been requested
+func writeReport(report *testing.Report) {
+	if reportFormat == "" {
+		return
+	}
+	if reportToStdout() {
+		err := report.Write(os.Stdout, reportFormat)
+		exitOnError(err, "writing report")
+		return
+	}
+	f, err := os.Create(reportFile)
+	exitOnError(err, "creating report-file")
+	defer f.Close()
+	err = report.Write(f, reportFormat)
+	exitOnError(err, "writing report")
+}
+
+// reportCoverage prints the coverage-summary to out and writes the coverage-files requested by the flags. Does nothing if coverage is nil
+func reportCoverage(coverage *testing.Coverage, out io.Writer) {
+	if coverage == nil {
+		return
+	}
+	if printCoverage {
+		fmt.Fprintln(out, "Coverage:")
+		err := coverage.WriteSummary(out)
+		exitOnError(err, "printing coverage")
+	}
+	if lcovFile != "" {
+		f, err := os.Create(lcovFile)
+		exitOnError(err, "creating lcov-file")
+		defer f.Close()
+		err = coverage.WriteLCOV(f)
+		exitOnError(err, "writing lcov-file")
+	}
+	if htmlFile != "" {
+		f, err := os.Create(htmlFile)
+		exitOnError(err, "creating html-file")
+		defer f.Close()
+		err = coverage.WriteHTML(f)
+		exitOnError(err, "writing html-file")
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(testCmd)
+	testCmd.Flags().Int64Var(&seed, "seed", 0, "Run chips that execute at the same time in a random order determined by this seed")
+	testCmd.Flags().IntVar(&fuzzRuns, "fuzz", 0, "Run every case additionally with the seeds 1 to N and report seeds that change the outputs")
+	testCmd.Flags().BoolVar(&printCoverage, "coverage", false, "Print the statement- and branch-coverage of the tested scripts")
+	testCmd.Flags().StringVar(&lcovFile, "lcov", "", "Write the coverage of the tested scripts to this file in lcov-format")
+	testCmd.Flags().StringVar(&htmlFile, "html", "", "Write the coverage of the tested scripts to this file as html-page")
+	testCmd.Flags().StringVar(&runPattern, "run", "", "Only run the cases whose name matches this regular expression")
+	testCmd.Flags().IntVar(&parallel, "parallel", 1, "Run up to N cases (of all test-files) at the same time")
+	testCmd.Flags().StringVar(&reportFormat, "report", "", "Write a report of the results of all cases. Available formats: junit, tap, json")
+	testCmd.Flags().StringVar(&reportFile, "report-file", "", "The file to write the report to. Defaults to stdout, in which case all other output is written to stderr")
+	testCmd.Flags().StringVar(&traceFile, "trace", "", "Record all lines executed by the tests to this file. Files ending in .csv are written as csv, all others as json-lines")
 }
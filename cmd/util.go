@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
 )
 
 var inputFile string
@@ -20,3 +23,27 @@ func loadInputFile(file string) string {
 	exitOnError(err, "Loading input file")
 	return string(f)
 }
+
+// createTrace returns a new trace if a trace-file has been given using --trace. Otherwise returns nil
+func createTrace() *vm.Trace {
+	if traceFile == "" {
+		return nil
+	}
+	return vm.NewTrace()
+}
+
+// writeTrace writes the trace to the file given using --trace. Does nothing if trace is nil
+func writeTrace(trace *vm.Trace) {
+	if trace == nil {
+		return
+	}
+	f, err := os.Create(traceFile)
+	exitOnError(err, "creating trace-file")
+	defer f.Close()
+	if strings.HasSuffix(strings.ToLower(traceFile), ".csv") {
+		err = trace.WriteCSV(f)
+	} else {
+		err = trace.WriteJSONLines(f)
+	}
+	exitOnError(err, "writing trace-file")
+}
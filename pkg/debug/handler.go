@@ -1,6 +1,7 @@
 package debug
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -8,14 +9,26 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/dbaumgarten/yodk/pkg/devices"
 	"github.com/dbaumgarten/yodk/pkg/vm"
 	"github.com/google/go-dap"
 )
 
 var globalVarsReference = 10000
+
+// the name of the read-only entry in the global scope that shows the simulated time of the coordinator
+var simulatedTimeVariable = "(simulated time)"
+
+// the ids of goto-targets are computed as (scriptindex+1)*gotoTargetScriptFactor + line
+var gotoTargetScriptFactor = 100000
+
+// separates the scope from the variable-name in the data-ids of data-breakpoints
+var dataIDSeparator = "/"
 var convertedCodeOffset = 10000
 
 // YODKHandler implements the handler-functions for a debug-session
@@ -23,26 +36,61 @@ type YODKHandler struct {
 	session         *Session
 	helper          *Helper
 	launchArguments map[string]interface{}
+	// the last runtime-error that paused a thread. Used to answer exceptionInfo-requests
+	lastErrors    map[int]error
+	lastErrorLock *sync.Mutex
 }
 
 // NewYODKHandler returns a new handler connected to the given session
 func NewYODKHandler() Handler {
-	return &YODKHandler{}
+	return &YODKHandler{
+		lastErrors:    make(map[int]error),
+		lastErrorLock: &sync.Mutex{},
+	}
+}
+
+// exceptionFilters are the exception-filters offered to the user. The "all" filter is enabled by default
+var exceptionFilters = []dap.ExceptionBreakpointsFilter{
+	{
+		Filter:  ExceptionFilterAll,
+		Label:   "All runtime errors",
+		Default: true,
+	},
+	{
+		Filter: vm.ErrKindStringCondition,
+		Label:  "String used as if-condition",
+	},
+	{
+		Filter: vm.ErrKindStringGoto,
+		Label:  "String used as goto-target",
+	},
+	{
+		Filter: vm.ErrKindDivisionByZero,
+		Label:  "Division by zero",
+	},
+	{
+		Filter: vm.ErrKindTypeMismatch,
+		Label:  "Operator not available for type",
+	},
+	{
+		Filter: vm.ErrKindEmptyString,
+		Label:  "Decrementing an empty string",
+	},
 }
 
 // OnInitializeRequest implements the Handler interface
-func (h *YODKHandler) OnInitializeRequest(arguments *dap.InitializeRequestArguments) (*dap.Capabilities, error) {
-	response := &dap.Capabilities{
+func (h *YODKHandler) OnInitializeRequest(arguments *dap.InitializeRequestArguments) (*Capabilities, error) {
+	capabilities := dap.Capabilities{
 		SupportsConfigurationDoneRequest:   true,
 		SupportsFunctionBreakpoints:        false,
-		SupportsConditionalBreakpoints:     false,
-		SupportsHitConditionalBreakpoints:  false,
-		SupportsEvaluateForHovers:          false,
-		ExceptionBreakpointFilters:         []dap.ExceptionBreakpointsFilter{},
-		SupportsStepBack:                   false,
+		SupportsConditionalBreakpoints:     true,
+		SupportsHitConditionalBreakpoints:  true,
+		SupportsEvaluateForHovers:          true,
+		ExceptionBreakpointFilters:         exceptionFilters,
+		SupportsStepBack:                   true,
 		SupportsSetVariable:                true,
 		SupportsRestartFrame:               false,
-		SupportsGotoTargetsRequest:         false,
+		SupportsGotoTargetsRequest:         true,
 		SupportsStepInTargetsRequest:       false,
 		SupportsCompletionsRequest:         false,
 		CompletionTriggerCharacters:        []string{},
@@ -52,19 +100,23 @@ func (h *YODKHandler) OnInitializeRequest(arguments *dap.InitializeRequestArgume
 		SupportsRestartRequest:             true,
 		SupportsExceptionOptions:           false,
 		SupportsValueFormattingOptions:     false,
-		SupportsExceptionInfoRequest:       false,
+		SupportsExceptionInfoRequest:       true,
 		SupportTerminateDebuggee:           true,
 		SupportsDelayedStackTraceLoading:   false,
 		SupportsLoadedSourcesRequest:       true,
-		SupportsLogPoints:                  false,
+		SupportsLogPoints:                  true,
 		SupportsTerminateThreadsRequest:    false,
 		SupportsSetExpression:              false,
 		SupportsTerminateRequest:           true,
-		SupportsDataBreakpoints:            false,
+		SupportsDataBreakpoints:            true,
 		SupportsReadMemoryRequest:          false,
 		SupportsDisassembleRequest:         false,
 		SupportsCancelRequest:              false,
-		SupportsBreakpointLocationsRequest: false,
+		SupportsBreakpointLocationsRequest: true,
+	}
+	response := &Capabilities{
+		Capabilities:                capabilities,
+		SupportsSteppingGranularity: true,
 	}
 	return response, nil
 }
@@ -85,6 +137,99 @@ func normalizePath(path string) string {
 }
 
 func (h *YODKHandler) helperFromArguments(arguments map[string]interface{}) (*Helper, error) {
+	helper, err := h.createHelper(arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	// overrides the error-mode of a test
+	if modefield, exists := arguments["errorMode"]; exists {
+		if modename, is := modefield.(string); is {
+			helper.ErrorMode, err = vm.ParseErrorMode(modename)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// overrides the idle-detection of a test
+	if idlefield, exists := arguments["detectIdle"]; exists {
+		if detectIdle, is := idlefield.(bool); is {
+			helper.DetectIdle = detectIdle
+		}
+	}
+
+	if snapshotfield, exists := arguments["snapshot"]; exists {
+		if snapshotfile, is := snapshotfield.(string); is {
+			snap, err := vm.LoadSnapshot(JoinPath(helper.Worspace, snapshotfile))
+			if err != nil {
+				return nil, err
+			}
+			err = helper.Coordinator.Restore(snap)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	networks := make(map[string][]string)
+	bridges := make([]vm.Bridge, 0)
+	err = parseLaunchField(arguments, "networks", &networks)
+	if err != nil {
+		return nil, err
+	}
+	err = parseLaunchField(arguments, "bridges", &bridges)
+	if err != nil {
+		return nil, err
+	}
+	err = helper.ConnectNetworks(networks, bridges)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make(map[string]map[string]string)
+	err = parseLaunchField(arguments, "aliases", &aliases)
+	if err != nil {
+		return nil, err
+	}
+	err = helper.SetAliases(aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, exists := arguments["devices"]; exists {
+		var configs []devices.Config
+		err = parseLaunchField(arguments, "devices", &configs)
+		if err != nil {
+			return nil, err
+		}
+		err = devices.Connect(helper.Coordinator, configs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return helper, nil
+}
+
+// parseLaunchField decodes the given field of the launch-arguments into target. Does nothing if the field is not set
+func parseLaunchField(arguments map[string]interface{}, name string, target interface{}) error {
+	field, exists := arguments[name]
+	if !exists {
+		return nil
+	}
+	encoded, err := json.Marshal(field)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(encoded, target)
+	if err != nil {
+		return fmt.Errorf("The '%s' field of the debug-config is invalid: %s", name, err.Error())
+	}
+	return nil
+}
+
+func (h *YODKHandler) createHelper(arguments map[string]interface{}) (*Helper, error) {
 
 	ws, _ := os.Getwd()
 	if workspacefield, exists := arguments["workspace"]; exists {
@@ -116,7 +261,7 @@ func (h *YODKHandler) helperFromArguments(arguments map[string]interface{}) (*He
 
 		if errsfield, exists := arguments["ignoreErrs"]; exists {
 			if ignoreErrs, is := errsfield.(bool); is {
-				helper.IgnoreErrs = ignoreErrs
+				helper.ExceptionFilters = DefaultExceptionFilters(ignoreErrs)
 			}
 		}
 		return helper, nil
@@ -169,19 +314,52 @@ func (h *YODKHandler) configureVM(yvm *vm.VM, filename string) {
 		})
 		return false
 	})
-	yvm.SetErrorHandler(func(x *vm.VM, err error) bool {
-		if !h.helper.IgnoreErrs {
+	yvm.SetErrorHandler(func(x *vm.VM, err error) {
+		if h.helper.BreakOnError(err) {
+			id := h.helper.ScriptIndexByName(filename) + 1
+			h.lastErrorLock.Lock()
+			h.lastErrors[id] = err
+			h.lastErrorLock.Unlock()
 			h.session.SendEvent(&dap.StoppedEvent{
 				Body: dap.StoppedEventBody{
 					Reason:      "exception",
 					Description: "A runtim-error occured",
-					ThreadId:    h.helper.ScriptIndexByName(filename) + 1,
+					ThreadId:    id,
 					Text:        err.Error(),
 				},
 			})
-			return false
 		}
-		return true
+	})
+	yvm.SetLogHandler(func(x *vm.VM, message string) {
+		h.session.SendEvent(&dap.OutputEvent{
+			Body: dap.OutputEventBody{
+				Category: "console",
+				Output:   message + "\n",
+				Source: dap.Source{
+					Path: JoinPath(h.helper.Worspace, filename),
+				},
+				Line: x.CurrentSourceLine(),
+			},
+		})
+	})
+	yvm.SetWatchpointHandler(func(x *vm.VM, name string, oldValue *vm.Variable, newValue *vm.Variable) bool {
+		id := h.helper.ScriptIndexByName(filename) + 1
+		if !strings.HasPrefix(name, ":") && h.helper.VariableTranslations[id-1] != nil {
+			name = h.helper.VariableTranslations[id-1][name]
+		}
+		oldRepr := "<unset>"
+		if oldValue != nil {
+			oldRepr = oldValue.Repr()
+		}
+		h.session.SendEvent(&dap.StoppedEvent{
+			Body: dap.StoppedEventBody{
+				Reason:      "data breakpoint",
+				Description: "Variable " + name + " changed",
+				ThreadId:    id,
+				Text:        fmt.Sprintf("%s: %s -> %s", name, oldRepr, newValue.Repr()),
+			},
+		})
+		return false
 	})
 	yvm.SetFinishHandler(func(x *vm.VM) {
 		id := h.helper.ScriptIndexByName(filename) + 1
@@ -271,11 +449,17 @@ func (h *YODKHandler) OnTerminateRequest(arguments *dap.TerminateArguments) erro
 // OnRestartRequest implements the Handler interface
 func (h *YODKHandler) OnRestartRequest(arguments *dap.RestartArguments) error {
 	go h.helper.Coordinator.Terminate()
+	// exception-filters are chosen per session and must survive a restart
+	filters := h.helper.ExceptionFilters
 	var err error
 	h.helper, err = h.helperFromArguments(h.launchArguments)
 	if err != nil {
 		return err
 	}
+	h.helper.ExceptionFilters = filters
+	h.lastErrorLock.Lock()
+	h.lastErrors = make(map[int]error)
+	h.lastErrorLock.Unlock()
 	h.session.SendEvent(&dap.InitializedEvent{})
 	return nil
 }
@@ -288,31 +472,60 @@ func (h *YODKHandler) OnSetBreakpointsRequest(arguments *dap.SetBreakpointsArgum
 	}
 	vm := h.helper.Vms[idx]
 
+	// older clients only send the line-numbers
+	requested := arguments.Breakpoints
+	if requested == nil {
+		requested = make([]dap.SourceBreakpoint, len(arguments.Lines))
+		for i, line := range arguments.Lines {
+			requested[i].Line = line
+		}
+	}
+
 	resp := &dap.SetBreakpointsResponseBody{
-		Breakpoints: make([]dap.Breakpoint, len(arguments.Lines)),
+		Breakpoints: make([]dap.Breakpoint, len(requested)),
 	}
 
 	for _, bp := range vm.ListBreakpoints() {
 		vm.RemoveBreakpoint(bp)
 	}
 
-	for i, bp := range arguments.Lines {
-		// if there is a table of valid breakpoints, use it to verify the breakpoint
-		if h.helper.ValidBreakpoints[idx] != nil {
-			if _, isValid := h.helper.ValidBreakpoints[idx][bp]; !isValid {
-				i--
-				continue
-			}
-		}
-		vm.AddBreakpoint(bp)
+	for i, sbp := range requested {
 		resp.Breakpoints[i] = dap.Breakpoint{
-			Line:     bp,
-			Verified: true,
+			Line: sbp.Line,
 			Source: dap.Source{
 				Name: arguments.Source.Name,
 				Path: arguments.Source.Path,
 			},
 		}
+		// if there is a table of valid breakpoints, use it to verify the breakpoint
+		if h.helper.ValidBreakpoints[idx] != nil {
+			if _, isValid := h.helper.ValidBreakpoints[idx][sbp.Line]; !isValid {
+				resp.Breakpoints[i].Message = "Breakpoints are not possible at this line"
+				continue
+			}
+		}
+		bp, err := h.helper.CreateBreakpoint(idx, sbp.Line, sbp.Condition, sbp.HitCondition, sbp.LogMessage)
+		if err != nil {
+			resp.Breakpoints[i].Message = err.Error()
+			continue
+		}
+		// breakpoints inside a line must be located at the beginning of a statement
+		// if the line only contains one statement, a line-breakpoint is used instead
+		statements := h.helper.StatementLocations(idx, sbp.Line, sbp.Line)
+		if sbp.Column > 0 && len(statements) > 1 {
+			for _, pos := range statements {
+				if pos.Coloumn == sbp.Column {
+					bp.Column = sbp.Column
+				}
+			}
+			if bp.Column == 0 {
+				resp.Breakpoints[i].Message = "There is no statement at this location"
+				continue
+			}
+			resp.Breakpoints[i].Column = bp.Column
+		}
+		vm.AddConditionalBreakpoint(bp)
+		resp.Breakpoints[i].Verified = true
 	}
 
 	return resp, nil
@@ -334,15 +547,42 @@ func (h *YODKHandler) OnSetFunctionBreakpointsRequest(arguments *dap.SetFunction
 
 // OnSetExceptionBreakpointsRequest implements the Handler interface
 func (h *YODKHandler) OnSetExceptionBreakpointsRequest(arguments *dap.SetExceptionBreakpointsArguments) error {
-	return ErrNotImplemented
+	filters := make(map[string]bool, len(arguments.Filters))
+	for _, filter := range arguments.Filters {
+		filters[filter] = true
+	}
+	h.helper.ExceptionFilters = filters
+	h.helper.ApplyErrorModes()
+	return nil
 }
 
 // OnConfigurationDoneRequest implements the Handler interface
 func (h *YODKHandler) OnConfigurationDoneRequest(arguments *dap.ConfigurationDoneArguments) error {
+	h.helper.ApplyErrorModes()
+	if h.helper.DetectIdle {
+		h.helper.Coordinator.SetIdleHandler(h.onIdle)
+	}
 	h.helper.Coordinator.Run()
 	return nil
 }
 
+// onIdle pauses all vms once they have become idle, so the user can find out what the scripts are waiting for
+func (h *YODKHandler) onIdle(err vm.IdleError) bool {
+	for _, v := range h.helper.Vms {
+		v.Pause()
+	}
+	h.session.SendEvent(&dap.StoppedEvent{
+		Body: dap.StoppedEventBody{
+			Reason:            "idle",
+			Description:       "All chips idle",
+			ThreadId:          h.helper.CurrentScript + 1,
+			Text:              err.Error(),
+			AllThreadsStopped: true,
+		},
+	})
+	return true
+}
+
 // OnContinueRequest implements the Handler interface
 func (h *YODKHandler) OnContinueRequest(arguments *dap.ContinueArguments) (*dap.ContinueResponseBody, error) {
 	if h.accessingFinishedVM(arguments.ThreadId) {
@@ -355,37 +595,93 @@ func (h *YODKHandler) OnContinueRequest(arguments *dap.ContinueArguments) (*dap.
 }
 
 // OnNextRequest implements the Handler interface
-func (h *YODKHandler) OnNextRequest(arguments *dap.NextArguments) error {
-	if h.accessingFinishedVM(arguments.ThreadId) {
-		return nil
-	}
-	h.helper.Vms[arguments.ThreadId-1].Step()
-	// the vm.StepHandler will send the event
-	return nil
+func (h *YODKHandler) OnNextRequest(arguments *NextArguments) error {
+	return h.step(arguments.ThreadId, arguments.Granularity)
 }
 
 // OnStepInRequest implements the Handler interface
-func (h *YODKHandler) OnStepInRequest(arguments *dap.StepInArguments) error {
-	return h.OnNextRequest(&dap.NextArguments{
-		ThreadId: arguments.ThreadId,
-	})
+// There are no functions to step into. Step-in behaves like next
+func (h *YODKHandler) OnStepInRequest(arguments *StepInArguments) error {
+	return h.step(arguments.ThreadId, arguments.Granularity)
 }
 
 // OnStepOutRequest implements the Handler interface
 func (h *YODKHandler) OnStepOutRequest(arguments *dap.StepOutArguments) error {
-	return h.OnNextRequest(&dap.NextArguments{
-		ThreadId: arguments.ThreadId,
-	})
+	return h.step(arguments.ThreadId, "line")
+}
+
+// step executes the next line (granularity "line" or "") or the next statement (granularity "statement" or "instruction")
+// of the given thread
+func (h *YODKHandler) step(threadID int, granularity string) error {
+	if h.accessingFinishedVM(threadID) {
+		return nil
+	}
+	switch granularity {
+	case "", "line":
+		h.helper.Vms[threadID-1].Step()
+	case "statement", "instruction":
+		h.helper.Vms[threadID-1].StepStatement()
+	default:
+		return fmt.Errorf("Unknown stepping granularity: %s", granularity)
+	}
+	// the vm.StepHandler will send the event
+	return nil
 }
 
 // OnStepBackRequest implements the Handler interface
 func (h *YODKHandler) OnStepBackRequest(arguments *dap.StepBackArguments) error {
-	return ErrNotImplemented
+	if h.accessingFinishedVM(arguments.ThreadId) {
+		return nil
+	}
+	reverted, err := h.helper.History.StepBackVM(h.helper.Vms[arguments.ThreadId-1])
+	if err != nil {
+		return err
+	}
+	if !reverted {
+		return errors.New("Can not step back any further")
+	}
+	h.session.SendEvent(&dap.StoppedEvent{
+		Body: dap.StoppedEventBody{
+			Reason:            "step",
+			Description:       "Stepped back",
+			ThreadId:          arguments.ThreadId,
+			AllThreadsStopped: true,
+		},
+	})
+	return nil
 }
 
 // OnReverseContinueRequest implements the Handler interface
 func (h *YODKHandler) OnReverseContinueRequest(arguments *dap.ReverseContinueArguments) error {
-	return ErrNotImplemented
+	if h.accessingFinishedVM(arguments.ThreadId) {
+		return nil
+	}
+	reason := "breakpoint"
+	description := "Breakpoint reached"
+	threadID := arguments.ThreadId
+	stoppedAt, err := h.helper.History.ReverseContinue()
+	if err != nil {
+		return err
+	}
+	if stoppedAt != nil {
+		for i, v := range h.helper.Vms {
+			if v == stoppedAt {
+				threadID = i + 1
+			}
+		}
+	} else {
+		reason = "entry"
+		description = "Reached the beginning of the recorded history"
+	}
+	h.session.SendEvent(&dap.StoppedEvent{
+		Body: dap.StoppedEventBody{
+			Reason:            reason,
+			Description:       description,
+			ThreadId:          threadID,
+			AllThreadsStopped: true,
+		},
+	})
+	return nil
 }
 
 // OnRestartFrameRequest implements the Handler interface
@@ -395,7 +691,26 @@ func (h *YODKHandler) OnRestartFrameRequest(arguments *dap.RestartFrameArguments
 
 // OnGotoRequest implements the Handler interface
 func (h *YODKHandler) OnGotoRequest(arguments *dap.GotoArguments) error {
-	return ErrNotImplemented
+	if h.accessingFinishedVM(arguments.ThreadId) {
+		return nil
+	}
+	idx := arguments.TargetId/gotoTargetScriptFactor - 1
+	line := arguments.TargetId % gotoTargetScriptFactor
+	if idx != arguments.ThreadId-1 {
+		return errors.New("The target is not located in the script of the selected thread")
+	}
+	err := h.helper.Vms[idx].JumpToLine(line)
+	if err != nil {
+		return err
+	}
+	h.session.SendEvent(&dap.StoppedEvent{
+		Body: dap.StoppedEventBody{
+			Reason:      "goto",
+			Description: "Moved execution",
+			ThreadId:    arguments.ThreadId,
+		},
+	})
+	return nil
 }
 
 // OnPauseRequest implements the Handler interface
@@ -483,6 +798,17 @@ func (h *YODKHandler) OnVariablesRequest(arguments *dap.VariablesArguments) (*da
 		i++
 	}
 
+	if arguments.VariablesReference == globalVarsReference {
+		resp.Variables = append(resp.Variables[:i], dap.Variable{
+			Name:  simulatedTimeVariable,
+			Value: h.helper.Coordinator.Now().String(),
+			PresentationHint: dap.VariablePresentationHint{
+				Kind:       "virtual",
+				Attributes: []string{"readOnly"},
+			},
+		})
+	}
+
 	return resp, nil
 
 }
@@ -491,6 +817,9 @@ func (h *YODKHandler) OnVariablesRequest(arguments *dap.VariablesArguments) (*da
 func (h *YODKHandler) OnSetVariableRequest(arguments *dap.SetVariableArguments) (*dap.SetVariableResponseBody, error) {
 	name := arguments.Name
 	value := vm.VariableFromString(arguments.Value)
+	if arguments.VariablesReference == globalVarsReference && name == simulatedTimeVariable {
+		return nil, errors.New("The simulated time can not be changed")
+	}
 	if arguments.VariablesReference == globalVarsReference {
 		h.helper.Coordinator.SetVariable(name, value)
 	} else {
@@ -553,7 +882,20 @@ func (h *YODKHandler) OnTerminateThreadsRequest(arguments *dap.TerminateThreadsA
 
 // OnEvaluateRequest implements the Handler interface
 func (h *YODKHandler) OnEvaluateRequest(arguments *dap.EvaluateArguments) (*dap.EvaluateResponseBody, error) {
-	return nil, ErrNotImplemented
+	// frame-ids are the same as the thread-ids. Without a frame, the expression is evaluated in the first script
+	vmidx := 0
+	if arguments.FrameId > 0 && arguments.FrameId <= len(h.helper.Vms) {
+		vmidx = arguments.FrameId - 1
+	}
+	result, err := h.helper.Evaluate(vmidx, arguments.Expression)
+	if err != nil {
+		return nil, err
+	}
+	resp := &dap.EvaluateResponseBody{
+		Result: result.Repr(),
+		Type:   result.TypeName(),
+	}
+	return resp, nil
 }
 
 // OnStepInTargetsRequest implements the Handler interface
@@ -563,7 +905,22 @@ func (h *YODKHandler) OnStepInTargetsRequest(arguments *dap.StepInTargetsArgumen
 
 // OnGotoTargetsRequest implements the Handler interface
 func (h *YODKHandler) OnGotoTargetsRequest(arguments *dap.GotoTargetsArguments) (*dap.GotoTargetsResponseBody, error) {
-	return nil, ErrNotImplemented
+	idx := h.helper.ScriptIndexByPath(arguments.Source.Path)
+	if idx == -1 {
+		return nil, errors.New("Source not found")
+	}
+	resp := &dap.GotoTargetsResponseBody{
+		Targets: []dap.GotoTarget{},
+	}
+	if h.helper.IsValidJumpTarget(idx, arguments.Line) {
+		resp.Targets = append(resp.Targets, dap.GotoTarget{
+			// the id encodes the script and the line of the target
+			Id:    (idx+1)*gotoTargetScriptFactor + arguments.Line,
+			Label: fmt.Sprintf("Line %d", arguments.Line),
+			Line:  arguments.Line,
+		})
+	}
+	return resp, nil
 }
 
 // OnCompletionsRequest implements the Handler interface
@@ -573,7 +930,38 @@ func (h *YODKHandler) OnCompletionsRequest(arguments *dap.CompletionsArguments)
 
 // OnExceptionInfoRequest implements the Handler interface
 func (h *YODKHandler) OnExceptionInfoRequest(arguments *dap.ExceptionInfoArguments) (*dap.ExceptionInfoResponseBody, error) {
-	return nil, ErrNotImplemented
+	h.lastErrorLock.Lock()
+	err, exists := h.lastErrors[arguments.ThreadId]
+	h.lastErrorLock.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("Thread %d has not encountered a runtime-error", arguments.ThreadId)
+	}
+
+	resp := &dap.ExceptionInfoResponseBody{
+		ExceptionId: vm.ErrKindOther,
+		Description: err.Error(),
+		BreakMode:   "always",
+		Details: dap.ExceptionDetails{
+			Message:  err.Error(),
+			TypeName: vm.ErrKindOther,
+		},
+	}
+
+	if rerr, is := err.(vm.RuntimeError); is {
+		operands := make([]string, len(rerr.Operands))
+		for i, op := range rerr.Operands {
+			operands[i] = op.Repr()
+		}
+		resp.ExceptionId = rerr.Kind
+		resp.Details.TypeName = rerr.Kind
+		resp.Details.Message = rerr.Base.Error()
+		resp.Description = fmt.Sprintf("%s (at %s up to %s)", rerr.Base.Error(), rerr.Node.Start(), rerr.Node.End())
+		if len(operands) > 0 {
+			resp.Description += fmt.Sprintf(". Operands: %s", strings.Join(operands, ", "))
+		}
+	}
+
+	return resp, nil
 }
 
 // OnLoadedSourcesRequest implements the Handler interface
@@ -600,12 +988,67 @@ func (h *YODKHandler) OnLoadedSourcesRequest(arguments *dap.LoadedSourcesArgumen
 
 // OnDataBreakpointInfoRequest implements the Handler interface
 func (h *YODKHandler) OnDataBreakpointInfoRequest(arguments *dap.DataBreakpointInfoArguments) (*dap.DataBreakpointInfoResponseBody, error) {
-	return nil, ErrNotImplemented
+	name := strings.ToLower(arguments.Name)
+	resp := &dap.DataBreakpointInfoResponseBody{
+		AccessTypes: []dap.DataBreakpointAccessType{"write"},
+	}
+	// data-ids have the form <scope>/<variable>. Scope is either "global" or the id of the thread the local variable belongs to
+	if arguments.VariablesReference == globalVarsReference || strings.HasPrefix(name, ":") {
+		if !strings.HasPrefix(name, ":") {
+			name = ":" + name
+		}
+		resp.DataId = "global" + dataIDSeparator + name
+		resp.Description = "Global variable " + name
+		return resp, nil
+	}
+	if arguments.VariablesReference < 1 || arguments.VariablesReference > len(h.helper.Vms) {
+		resp.DataId = nil
+		resp.Description = "Data breakpoints are only available for variables"
+		return resp, nil
+	}
+	compiledName := h.helper.ReverseVarnameTranslation(arguments.VariablesReference-1, name)
+	if compiledName == "" {
+		compiledName = name
+	}
+	resp.DataId = strconv.Itoa(arguments.VariablesReference) + dataIDSeparator + compiledName
+	resp.Description = "Variable " + name + " of " + h.helper.ScriptNames[arguments.VariablesReference-1]
+	return resp, nil
 }
 
 // OnSetDataBreakpointsRequest implements the Handler interface
 func (h *YODKHandler) OnSetDataBreakpointsRequest(arguments *dap.SetDataBreakpointsArguments) (*dap.SetDataBreakpointsResponseBody, error) {
-	return nil, ErrNotImplemented
+	for _, name := range h.helper.Coordinator.ListWatchpoints() {
+		h.helper.Coordinator.RemoveWatchpoint(name)
+	}
+	for _, v := range h.helper.Vms {
+		for _, name := range v.ListWatchpoints() {
+			v.RemoveWatchpoint(name)
+		}
+	}
+
+	resp := &dap.SetDataBreakpointsResponseBody{
+		Breakpoints: make([]dap.Breakpoint, len(arguments.Breakpoints)),
+	}
+	for i, bp := range arguments.Breakpoints {
+		parts := strings.SplitN(bp.DataId, dataIDSeparator, 2)
+		if len(parts) != 2 {
+			resp.Breakpoints[i].Message = "Invalid data-id: " + bp.DataId
+			continue
+		}
+		if parts[0] == "global" {
+			h.helper.Coordinator.AddWatchpoint(parts[1])
+			resp.Breakpoints[i].Verified = true
+			continue
+		}
+		threadID, err := strconv.Atoi(parts[0])
+		if err != nil || threadID < 1 || threadID > len(h.helper.Vms) {
+			resp.Breakpoints[i].Message = "Invalid data-id: " + bp.DataId
+			continue
+		}
+		h.helper.Vms[threadID-1].AddWatchpoint(parts[1])
+		resp.Breakpoints[i].Verified = true
+	}
+	return resp, nil
 }
 
 // OnReadMemoryRequest implements the Handler interface
@@ -625,5 +1068,22 @@ func (h *YODKHandler) OnCancelRequest(arguments *dap.CancelArguments) error {
 
 // OnBreakpointLocationsRequest implements the Handler interface
 func (h *YODKHandler) OnBreakpointLocationsRequest(arguments *dap.BreakpointLocationsArguments) (*dap.BreakpointLocationsResponseBody, error) {
-	return nil, ErrNotImplemented
+	idx := h.helper.ScriptIndexByPath(arguments.Source.Path)
+	if idx == -1 {
+		return nil, errors.New("Source not found")
+	}
+	endLine := arguments.EndLine
+	if endLine < arguments.Line {
+		endLine = arguments.Line
+	}
+	resp := &dap.BreakpointLocationsResponseBody{
+		Breakpoints: []dap.BreakpointLocation{},
+	}
+	for _, pos := range h.helper.StatementLocations(idx, arguments.Line, endLine) {
+		resp.Breakpoints = append(resp.Breakpoints, dap.BreakpointLocation{
+			Line:   pos.Line,
+			Column: pos.Coloumn,
+		})
+	}
+	return resp, nil
 }
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
 	"github.com/dbaumgarten/yodk/pkg/parser"
 	"github.com/dbaumgarten/yodk/pkg/parser/ast"
 	"github.com/dbaumgarten/yodk/pkg/testing"
@@ -39,12 +41,40 @@ type Helper struct {
 	// If no value is returned for a script, all breakpoints are valid.
 	// This is needed because in a nolol-script not every line is valid for a breakpoint
 	ValidBreakpoints map[int]map[int]bool
+	// Definitions contains the constants defined in the nolol-scripts of the VMs
+	// used to evaluate expressions that contain constants
+	Definitions []map[string]ast.Expression
 	// CompiledCode contains the generated yolol-code for for VMs that are running NOLOL
 	CompiledCode map[int]string
-	// If set to true, runtime-errors should not interrupt script execution
-	IgnoreErrs bool
+	// ExceptionFilters contains the categories of runtime-errors that interrupt script execution.
+	// Keys are ExceptionFilterAll or one of the vm.ErrKind* constants
+	ExceptionFilters map[string]bool
+	// ErrorMode is the reaction (one of the vm.ErrorMode* constants) to runtime-errors that do not match the ExceptionFilters.
+	// Errors matching the filters always pause the vm. Apply changes using ApplyErrorModes()
+	ErrorMode int
+	// DetectIdle enables pausing all vms once they have become idle (see vm.Coordinator.EnableIdleDetection())
+	DetectIdle bool
+	// History records the lines executed by all vms. Used to step backwards
+	History *vm.History
 }
 
+// ExceptionFilterAll is the exception-filter that matches every kind of runtime-error
+const ExceptionFilterAll = "all"
+
+// DefaultExceptionFilters returns the exception-filters to use for a new debug-session.
+// If ignoreErrs is true, no runtime-error interrupts the execution. Otherwise all of them do.
+func DefaultExceptionFilters(ignoreErrs bool) map[string]bool {
+	if ignoreErrs {
+		return map[string]bool{}
+	}
+	return map[string]bool{
+		ExceptionFilterAll: true,
+	}
+}
+
+// HistorySize is the number of executed lines the Helper remembers for stepping backwards
+var HistorySize = 10000
+
 // JoinPath wraps filepath.Join, but returns only the second part if the second part is an absolute path
 func JoinPath(base string, other string) string {
 	if filepath.IsAbs(other) || base == "" {
@@ -86,6 +116,176 @@ func (h Helper) ReverseVarnameTranslation(vmidx int, search string) string {
 	return ""
 }
 
+// CreateBreakpoint creates a (conditional) breakpoint for the script with the given index.
+// Variable-names in the condition and the log-message refer to the original source-code and are
+// translated to the names used by the compiled code
+func (h Helper) CreateBreakpoint(vmidx int, line int, condition string, hitCondition string, logMessage string) (*vm.Breakpoint, error) {
+	if h.VariableTranslations[vmidx] != nil {
+		if strings.TrimSpace(condition) != "" {
+			expr, err := h.parseExpression(vmidx, condition)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid breakpoint-condition: %s", err.Error())
+			}
+			condition, err = (&parser.Printer{}).Print(expr)
+			if err != nil {
+				return nil, err
+			}
+		}
+		logMessage = logVariableRegex.ReplaceAllStringFunc(logMessage, func(match string) string {
+			return "{" + h.translateVarname(vmidx, strings.TrimSpace(match[1:len(match)-1])) + "}"
+		})
+	}
+	return vm.NewBreakpoint(line, condition, hitCondition, logMessage)
+}
+
+// Evaluate evaluates the given expression in the context of the script with the given index.
+// For nolol-scripts, the expression can use the original variable-names and defined constants
+func (h Helper) Evaluate(vmidx int, expression string) (*vm.Variable, error) {
+	expr, err := h.parseExpression(vmidx, expression)
+	if err != nil {
+		return nil, err
+	}
+	return h.Vms[vmidx].EvaluateExpression(expr)
+}
+
+// parseExpression parses an expression that refers to the source-code of the script with the given index.
+// For nolol-scripts, definitions are replaced by their values and variable-names are translated
+// to the names used by the compiled code
+func (h Helper) parseExpression(vmidx int, expression string) (ast.Expression, error) {
+	if h.VariableTranslations[vmidx] == nil {
+		return parser.NewParser().ParseExpressionString(expression)
+	}
+	expr, err := nolol.NewParser().ParseExpressionString(expression)
+	if err != nil {
+		return nil, err
+	}
+	var definitions map[string]ast.Expression
+	if vmidx < len(h.Definitions) {
+		definitions = h.Definitions[vmidx]
+	}
+	// protects against definitions that (indirectly) refer to themselves
+	replacements := 0
+	return ast.MustExpression(ast.AcceptChild(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is {
+			if value, isDefinition := definitions[strings.ToLower(deref.Variable)]; isDefinition && deref.Operator == "" {
+				replacements++
+				if replacements > maxDefinitionReplacements {
+					return fmt.Errorf("Too many nested definitions in expression")
+				}
+				return ast.NewNodeReplacement(nast.CopyAst(value))
+			}
+			deref.Variable = h.translateVarname(vmidx, deref.Variable)
+		}
+		return nil
+	}), expr))
+}
+
+// maximum number of definitions that are resolved in a single expression
+var maxDefinitionReplacements = 1000
+
+var logVariableRegex = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// translateVarname returns the name a variable of the original source-code has in the compiled code
+func (h Helper) translateVarname(vmidx int, name string) string {
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, ":") {
+		return name
+	}
+	translated := h.ReverseVarnameTranslation(vmidx, name)
+	if translated == "" {
+		return name
+	}
+	return translated
+}
+
+// IsValidJumpTarget returns true if the execution of the script with the given index can be moved to the given line
+func (h Helper) IsValidJumpTarget(vmidx int, line int) bool {
+	// in nolol-scripts not every line is valid
+	if validBps, exists := h.ValidBreakpoints[vmidx]; exists {
+		if _, isValid := validBps[line]; !isValid {
+			return false
+		}
+	}
+	for _, target := range h.Vms[vmidx].JumpTargets() {
+		if target == line {
+			return true
+		}
+	}
+	return false
+}
+
+// StatementLocations returns the positions of all statements of the script with the given index,
+// that are located between startLine and endLine (inclusive). Breakpoints can be set at these positions
+func (h Helper) StatementLocations(vmidx int, startLine int, endLine int) []ast.Position {
+	locations := make([]ast.Position, 0)
+	for _, pos := range findStatementLocations(h.Vms[vmidx].GetProgram()) {
+		if pos.Line >= startLine && pos.Line <= endLine {
+			locations = append(locations, pos)
+		}
+	}
+	return locations
+}
+
+// BreakOnError returns true if the given runtime-error matches one of the active exception-filters
+// and should therefore interrupt the execution
+func (h Helper) BreakOnError(err error) bool {
+	if h.ExceptionFilters[ExceptionFilterAll] || h.ErrorMode == vm.ErrorModePause {
+		return true
+	}
+	kind := vm.ErrKindOther
+	if rerr, is := err.(vm.RuntimeError); is {
+		kind = rerr.Kind
+	}
+	return h.ExceptionFilters[kind]
+}
+
+// ApplyErrorModes configures the reaction of the vms to runtime-errors:
+// errors matching the ExceptionFilters pause the vm, all other errors are handled according to ErrorMode
+func (h Helper) ApplyErrorModes() {
+	for _, v := range h.Vms {
+		if h.ExceptionFilters[ExceptionFilterAll] {
+			v.SetErrorMode(vm.ErrorModePause)
+			continue
+		}
+		v.SetErrorMode(h.ErrorMode)
+		for kind, enabled := range h.ExceptionFilters {
+			if enabled {
+				v.SetErrorModeForKind(kind, vm.ErrorModePause)
+			}
+		}
+	}
+}
+
+// ConnectNetworks connects the scripts to data-networks and adds bridges between the networks.
+// networks maps script-names to the names of the networks the script is connected to.
+// Scripts without an entry stay connected to their current networks
+func (h Helper) ConnectNetworks(networks map[string][]string, bridges []vm.Bridge) error {
+	for script, names := range networks {
+		idx := h.ScriptIndexByName(script)
+		if idx < 0 {
+			return fmt.Errorf("Networks are set for '%s', but there is no such script", script)
+		}
+		h.Coordinator.SetNetworks(h.Vms[idx], names...)
+	}
+	for _, bridge := range bridges {
+		h.Coordinator.AddBridge(bridge)
+	}
+	return nil
+}
+
+// SetAliases sets aliases for the global variables used by the scripts. Keys are script-names, values map the names
+// used in the script to the names of the accessed globals (see vm.Coordinator.SetAliases())
+func (h Helper) SetAliases(aliases map[string]map[string]string) error {
+	for script, scriptAliases := range aliases {
+		idx := h.ScriptIndexByName(script)
+		if idx < 0 {
+			return fmt.Errorf("Aliases are set for '%s', but there is no such script", script)
+		}
+		h.Coordinator.SetAliases(h.Vms[idx], scriptAliases)
+	}
+	return nil
+}
+
 // CurrentVM returns the currently selected VM (only used in cli-debugger)
 func (h Helper) CurrentVM() *vm.VM {
 	return h.Vms[h.CurrentScript]
@@ -98,9 +298,11 @@ type VMPrepareFunc func(yvm *vm.VM, filename string)
 // FromScripts receives a list of yolol/nolol filenames and creates a Helper from them
 func FromScripts(workspace string, scripts []string, prepareVM VMPrepareFunc) (*Helper, error) {
 	h := &Helper{
+		ErrorMode:            vm.ErrorModeAbortLine,
 		ScriptNames:          scripts,
 		Scripts:              make([]string, len(scripts)),
 		VariableTranslations: make([]map[string]string, len(scripts)),
+		Definitions:          make([]map[string]ast.Expression, len(scripts)),
 		Vms:                  make([]*vm.VM, len(scripts)),
 		CurrentScript:        0,
 		Coordinator:          vm.NewCoordinator(),
@@ -108,6 +310,8 @@ func FromScripts(workspace string, scripts []string, prepareVM VMPrepareFunc) (*
 		FinishedVMs:          make(map[int]bool),
 		ValidBreakpoints:     make(map[int]map[int]bool),
 		CompiledCode:         make(map[int]string),
+		ExceptionFilters:     DefaultExceptionFilters(false),
+		History:              vm.NewHistory(HistorySize),
 	}
 
 	for i, inputFileName := range h.ScriptNames {
@@ -133,6 +337,7 @@ func FromScripts(workspace string, scripts []string, prepareVM VMPrepareFunc) (*
 			}
 			h.ValidBreakpoints[i] = findValidBreakpoints(yololcode)
 			h.VariableTranslations[i] = converter.GetVariableTranslations()
+			h.Definitions[i] = converter.GetDefinitions()
 			pri := parser.Printer{
 				Mode: parser.PrintermodeReadable,
 			}
@@ -145,6 +350,7 @@ func FromScripts(workspace string, scripts []string, prepareVM VMPrepareFunc) (*
 
 		h.Vms[i] = thisVM
 		thisVM.SetCoordinator(h.Coordinator)
+		thisVM.SetHistory(h.History)
 		prepareVM(thisVM, inputFileName)
 		thisVM.Resume()
 	}
@@ -164,7 +370,14 @@ func FromTest(workspace string, testfile string, casenr int, prepareVM VMPrepare
 		return nil, err
 	}
 
+	errorMode, err := vm.ParseErrorMode(t.ErrorMode)
+	if err != nil {
+		return nil, err
+	}
+
 	h := &Helper{
+		ErrorMode:            errorMode,
+		DetectIdle:           t.DetectIdle,
 		ScriptNames:          make([]string, len(t.Scripts)),
 		Scripts:              make([]string, len(t.Scripts)),
 		VariableTranslations: make([]map[string]string, len(t.Scripts)),
@@ -175,7 +388,8 @@ func FromTest(workspace string, testfile string, casenr int, prepareVM VMPrepare
 		FinishedVMs:          make(map[int]bool),
 		ValidBreakpoints:     make(map[int]map[int]bool),
 		CompiledCode:         make(map[int]string),
-		IgnoreErrs:           t.IgnoreErrs,
+		ExceptionFilters:     DefaultExceptionFilters(t.IgnoreErrs),
+		History:              vm.NewHistory(HistorySize),
 	}
 
 	for i, script := range t.Scripts {
@@ -198,8 +412,10 @@ func FromTest(workspace string, testfile string, casenr int, prepareVM VMPrepare
 	h.Vms = runner.VMs
 	h.Coordinator = runner.Coordinator
 	h.VariableTranslations = runner.VarTranslations
+	h.Definitions = runner.Definitions
 
 	for i, iv := range h.Vms {
+		iv.SetHistory(h.History)
 		prepareVM(iv, h.ScriptNames[i])
 		if strings.HasSuffix(h.ScriptNames[i], ".nolol") {
 			h.ValidBreakpoints[i] = findValidBreakpoints(iv.GetProgram())
@@ -242,3 +458,25 @@ func findValidBreakpoints(prog *ast.Program) map[int]bool {
 	}))
 	return valid
 }
+
+// returns the start-positions of all statements (including the ones nested inside ifs) of the given program
+// statements that originate from included files are ignored
+func findStatementLocations(prog *ast.Program) []ast.Position {
+	locations := make([]ast.Position, 0)
+	var addStatements func(stmts []ast.Statement)
+	addStatements = func(stmts []ast.Statement) {
+		for _, stmt := range stmts {
+			if stmt.Start().File == "" {
+				locations = append(locations, stmt.Start())
+			}
+			if ifstmt, isIf := stmt.(*ast.IfStatement); isIf {
+				addStatements(ifstmt.IfBlock)
+				addStatements(ifstmt.ElseBlock)
+			}
+		}
+	}
+	for _, line := range prog.Lines {
+		addStatements(line.Statements)
+	}
+	return locations
+}
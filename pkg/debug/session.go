@@ -33,6 +33,33 @@ import (
 // ErrNotImplemented is returned by a handler if the called method is not implemented
 var ErrNotImplemented = errors.New("This call has not been implemented")
 
+// Capabilities extends dap.Capabilities with the capabilities the dap-library does not support yet
+type Capabilities struct {
+	dap.Capabilities
+	SupportsSteppingGranularity bool `json:"supportsSteppingGranularity,omitempty"`
+}
+
+// initializeResponse is a dap.InitializeResponse with the extended capabilities
+type initializeResponse struct {
+	dap.Response
+	Body Capabilities `json:"body"`
+}
+
+// GetResponse implements dap.ResponseMessage
+func (r *initializeResponse) GetResponse() *dap.Response { return &r.Response }
+
+// NextArguments extends dap.NextArguments with the granularity of the step ("statement", "line" or "instruction")
+type NextArguments struct {
+	dap.NextArguments
+	Granularity string `json:"granularity,omitempty"`
+}
+
+// StepInArguments extends dap.StepInArguments with the granularity of the step ("statement", "line" or "instruction")
+type StepInArguments struct {
+	dap.StepInArguments
+	Granularity string `json:"granularity,omitempty"`
+}
+
 // StartSession handles a session with a single client.
 // It reads and decodes the incoming data and dispatches it
 // to per-request processing goroutines. It also launches the
@@ -129,7 +156,11 @@ func (ds *Session) SendEvent(event dap.EventMessage) {
 }
 
 func (ds *Session) handleRequest() error {
-	request, err := dap.ReadProtocolMessage(ds.rw.Reader)
+	content, err := dap.ReadBaseMessage(ds.rw.Reader)
+	if err != nil {
+		return err
+	}
+	request, err := dap.DecodeProtocolMessage(content)
 	if err != nil {
 		if strings.Contains(err.Error(), "not supported") {
 			log.Println("Ignoring invalid request:", err)
@@ -143,7 +174,7 @@ func (ds *Session) handleRequest() error {
 	}
 	ds.sendWg.Add(1)
 	go func() {
-		ds.dispatchRequest(request)
+		ds.dispatchRequest(request, content)
 		ds.sendWg.Done()
 	}()
 	return nil
@@ -151,7 +182,8 @@ func (ds *Session) handleRequest() error {
 
 // dispatchRequest launches a new goroutine to process each request
 // and send back events and responses.
-func (ds *Session) dispatchRequest(m dap.Message) {
+// content is the raw request. It is used to decode arguments the dap-library does not support yet
+func (ds *Session) dispatchRequest(m dap.Message, content []byte) {
 
 	defer func() {
 		err := recover()
@@ -175,7 +207,7 @@ func (ds *Session) dispatchRequest(m dap.Message) {
 		body, err := ds.handler.OnInitializeRequest(&r.Arguments)
 		resperr = err
 		if body != nil {
-			response = &dap.InitializeResponse{
+			response = &initializeResponse{
 				Body: *body,
 			}
 		}
@@ -225,10 +257,18 @@ func (ds *Session) dispatchRequest(m dap.Message) {
 			}
 		}
 	case *dap.NextRequest:
-		resperr = ds.handler.OnNextRequest(&r.Arguments)
+		arguments := NextArguments{}
+		resperr = decodeArguments(content, &arguments)
+		if resperr == nil {
+			resperr = ds.handler.OnNextRequest(&arguments)
+		}
 		response = &dap.NextResponse{}
 	case *dap.StepInRequest:
-		resperr = ds.handler.OnStepInRequest(&r.Arguments)
+		arguments := StepInArguments{}
+		resperr = decodeArguments(content, &arguments)
+		if resperr == nil {
+			resperr = ds.handler.OnStepInRequest(&arguments)
+		}
 		response = &dap.StepInResponse{}
 	case *dap.StepOutRequest:
 		resperr = ds.handler.OnStepOutRequest(&r.Arguments)
@@ -423,6 +463,16 @@ func (ds *Session) dispatchRequest(m dap.Message) {
 	}
 }
 
+// decodeArguments decodes the arguments of the raw request into target
+func decodeArguments(content []byte, target interface{}) error {
+	request := struct {
+		Arguments interface{} `json:"arguments"`
+	}{
+		Arguments: target,
+	}
+	return json.Unmarshal(content, &request)
+}
+
 // send lets the sender goroutine know via a channel that there is
 // a message to be sent to client. This is called by per-request
 // goroutines to send events and responses for each request and
@@ -469,7 +519,7 @@ func newErrorResponse(request dap.RequestMessage, message string) *dap.ErrorResp
 // Handler defines an interface that debug adapter protocol handlers must implement
 type Handler interface {
 	SetSession(s *Session)
-	OnInitializeRequest(arguments *dap.InitializeRequestArguments) (*dap.Capabilities, error)
+	OnInitializeRequest(arguments *dap.InitializeRequestArguments) (*Capabilities, error)
 	OnLaunchRequest(arguments map[string]interface{}) error
 	OnAttachRequest(arguments *dap.AttachRequestArguments) error
 	OnDisconnectRequest(arguments *dap.DisconnectArguments) error
@@ -480,8 +530,8 @@ type Handler interface {
 	OnSetExceptionBreakpointsRequest(arguments *dap.SetExceptionBreakpointsArguments) error
 	OnConfigurationDoneRequest(arguments *dap.ConfigurationDoneArguments) error
 	OnContinueRequest(arguments *dap.ContinueArguments) (*dap.ContinueResponseBody, error)
-	OnNextRequest(arguments *dap.NextArguments) error
-	OnStepInRequest(arguments *dap.StepInArguments) error
+	OnNextRequest(arguments *NextArguments) error
+	OnStepInRequest(arguments *StepInArguments) error
 	OnStepOutRequest(arguments *dap.StepOutArguments) error
 	OnStepBackRequest(arguments *dap.StepBackArguments) error
 	OnReverseContinueRequest(arguments *dap.ReverseContinueArguments) error
@@ -0,0 +1,168 @@
+package devices
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// Config describes a device that is connected to the simulated network.
+// It is used in test-files and debug launch-configurations
+type Config struct {
+	// The type of the device (see Types())
+	Type string
+	// Renames the fields of the device. Keys are the default field-names, values are the names to use instead.
+	// This is needed when multiple devices of the same type are connected to the same network
+	Fields map[string]string
+	// Type-specific options, like the speed of a hinge
+	Options map[string]interface{}
+	// Initial values for fields of the device. Keys are the field-names (after renaming).
+	// For memory-chips, this also defines which fields the chip has
+	Values map[string]interface{}
+	// The data-network the device is connected to. Defaults to vm.DefaultNetwork
+	Network string
+}
+
+// factory creates a device from a config
+type factory func(cfg Config) (vm.Device, error)
+
+var factories = map[string]factory{
+	"button":    newButton,
+	"lamp":      newLamp,
+	"textpanel": newTextPanel,
+	"fueltank":  newFuelTank,
+	"hinge":     newHinge,
+	"memory":    newMemory,
+}
+
+// Types returns the names of all available device-types
+func Types() []string {
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Create creates a new device from the given config
+func Create(cfg Config) (vm.Device, error) {
+	create, exists := factories[strings.ToLower(cfg.Type)]
+	if !exists {
+		return nil, fmt.Errorf("Unknown device-type '%s'. Available types are: %s", cfg.Type, strings.Join(Types(), ", "))
+	}
+	d, err := create(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Device '%s': %s", cfg.Type, err.Error())
+	}
+	fields := d.Fields()
+	for name, value := range cfg.Values {
+		if _, exists := fields[vm.QualifiedName(vm.DefaultNetwork, name)]; !exists {
+			return nil, fmt.Errorf("Device '%s': The device has no field named '%s'", cfg.Type, name)
+		}
+		if _, err := vm.VariableFromType(value); err != nil {
+			return nil, fmt.Errorf("Device '%s': Invalid value for field '%s': %s", cfg.Type, name, err.Error())
+		}
+	}
+	return d, nil
+}
+
+// Connect creates all the devices from the configs and adds them to the coordinator
+func Connect(coord *vm.Coordinator, configs []Config) error {
+	for _, cfg := range configs {
+		d, err := Create(cfg)
+		if err != nil {
+			return err
+		}
+		err = coord.AddNetworkDevice(cfg.Network, d)
+		if err != nil {
+			return err
+		}
+		// set the initial values like a script would, so the device can react to them
+		for name, value := range cfg.Values {
+			variable, err := vm.VariableFromType(value)
+			if err != nil {
+				return err
+			}
+			coord.SetVariable(vm.QualifiedName(cfg.Network, name), variable)
+		}
+	}
+	return nil
+}
+
+// fieldNames maps the default field-names of a device to the names of the global variables used for the fields
+type fieldNames struct {
+	globals map[string]string
+	locals  map[string]string
+}
+
+// newFieldNames applies the renames from the config to the given default field-names
+func newFieldNames(renames map[string]string, defaults ...string) (fieldNames, error) {
+	f := fieldNames{
+		globals: make(map[string]string, len(defaults)),
+		locals:  make(map[string]string, len(defaults)),
+	}
+	for _, name := range defaults {
+		f.globals[name] = ":" + name
+	}
+	for from, to := range renames {
+		from = strings.TrimPrefix(strings.ToLower(from), ":")
+		if _, exists := f.globals[from]; !exists {
+			return f, fmt.Errorf("The device has no field named '%s'", from)
+		}
+		f.globals[from] = ":" + strings.TrimPrefix(strings.ToLower(to), ":")
+	}
+	for local, global := range f.globals {
+		f.locals[global] = local
+	}
+	return f, nil
+}
+
+// global returns the global variable used for the given default field-name
+func (f fieldNames) global(local string) string {
+	return f.globals[local]
+}
+
+// local returns the default field-name for the given global variable
+func (f fieldNames) local(global string) string {
+	return f.locals[global]
+}
+
+// numberOption returns the numeric option with the given name, or def if the option is not set
+func numberOption(cfg Config, name string, def float64) (float64, error) {
+	value, exists := cfg.Options[name]
+	if !exists {
+		return def, nil
+	}
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("The option '%s' must be a number", name)
+}
+
+// checkOptions returns an error if the config contains any option not contained in known
+func checkOptions(cfg Config, known ...string) error {
+	for name := range cfg.Options {
+		found := false
+		for _, k := range known {
+			if name == k {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("Unknown option '%s'", name)
+		}
+	}
+	return nil
+}
+
+// numberVariable creates a new number-variable
+func numberVariable(value float64) *vm.Variable {
+	v, _ := vm.VariableFromType(value)
+	return v
+}
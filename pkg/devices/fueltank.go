@@ -0,0 +1,107 @@
+package devices
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// fuelTank is a tank that is drained at a rate that can be set by the scripts.
+// Fields: fuel (the current amount), maxfuel (the capacity) and fuelconsumption (units per second)
+type fuelTank struct {
+	names       fieldNames
+	lock        *sync.Mutex
+	fuel        float64
+	capacity    float64
+	consumption float64
+	lastUpdate  time.Duration
+}
+
+// newFuelTank creates a fuel-tank. Options: capacity (default 100), fuel (the initial amount, default capacity)
+// and consumption (the initial consumption in units per second, default 0)
+func newFuelTank(cfg Config) (vm.Device, error) {
+	err := checkOptions(cfg, "capacity", "fuel", "consumption")
+	if err != nil {
+		return nil, err
+	}
+	names, err := newFieldNames(cfg.Fields, "fuel", "maxfuel", "fuelconsumption")
+	if err != nil {
+		return nil, err
+	}
+	capacity, err := numberOption(cfg, "capacity", 100)
+	if err != nil {
+		return nil, err
+	}
+	fuel, err := numberOption(cfg, "fuel", capacity)
+	if err != nil {
+		return nil, err
+	}
+	consumption, err := numberOption(cfg, "consumption", 0)
+	if err != nil {
+		return nil, err
+	}
+	return &fuelTank{
+		names:       names,
+		lock:        &sync.Mutex{},
+		fuel:        fuel,
+		capacity:    capacity,
+		consumption: consumption,
+	}, nil
+}
+
+// Fields is needed to implement vm.Device
+func (f *fuelTank) Fields() map[string]*vm.Variable {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return map[string]*vm.Variable{
+		f.names.global("fuel"):            numberVariable(f.fuel),
+		f.names.global("maxfuel"):         numberVariable(f.capacity),
+		f.names.global("fuelconsumption"): numberVariable(f.consumption),
+	}
+}
+
+// OnWrite is needed to implement vm.Device
+func (f *fuelTank) OnWrite(field string, value *vm.Variable, now time.Duration) {
+	if !value.IsNumber() {
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch f.names.local(field) {
+	case "fuel":
+		f.fuel = value.Number().Float64()
+	case "maxfuel":
+		f.capacity = value.Number().Float64()
+	case "fuelconsumption":
+		f.consumption = value.Number().Float64()
+	}
+}
+
+// Active is needed to implement vm.ActiveDevice
+func (f *fuelTank) Active() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return (f.consumption > 0 && f.fuel > 0) || (f.consumption < 0 && f.fuel < f.capacity)
+}
+
+// Update is needed to implement vm.Device
+func (f *fuelTank) Update(now time.Duration) map[string]*vm.Variable {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	elapsed := (now - f.lastUpdate).Seconds()
+	f.lastUpdate = now
+	if f.consumption == 0 {
+		return nil
+	}
+	f.fuel -= f.consumption * elapsed
+	if f.fuel < 0 {
+		f.fuel = 0
+	}
+	if f.fuel > f.capacity {
+		f.fuel = f.capacity
+	}
+	return map[string]*vm.Variable{
+		f.names.global("fuel"): numberVariable(f.fuel),
+	}
+}
@@ -0,0 +1,54 @@
+package devices_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/devices"
+)
+
+func TestFuelTank(t *testing.T) {
+	cases := []struct {
+		name    string
+		options map[string]interface{}
+		steps   []deviceStep
+	}{
+		{"Idle", nil, []deviceStep{
+			{at: time.Second, expected: 100, active: false},
+		}},
+		{"Drain", map[string]interface{}{"consumption": 10}, []deviceStep{
+			{at: time.Second, expected: 90, active: true},
+			{at: 1500 * time.Millisecond, expected: 85, active: true},
+		}},
+		{"Drain until empty", map[string]interface{}{"fuel": 15, "consumption": 10}, []deviceStep{
+			{at: time.Second, expected: 5, active: true},
+			{at: 2 * time.Second, expected: 0, active: false},
+			{at: 3 * time.Second, expected: 0, active: false},
+		}},
+		{"Start draining", nil, []deviceStep{
+			{at: time.Second, field: ":fuelconsumption", value: 20, expected: 100, active: true},
+			{at: 2 * time.Second, expected: 80, active: true},
+			{at: 2 * time.Second, field: ":fuelconsumption", value: 0, expected: 80, active: false},
+			{at: 3 * time.Second, expected: 80, active: false},
+		}},
+		{"Refill until full", map[string]interface{}{"fuel": 50, "consumption": -20}, []deviceStep{
+			{at: 2 * time.Second, expected: 90, active: true},
+			{at: 3 * time.Second, expected: 100, active: false},
+		}},
+		{"Refill an empty tank", map[string]interface{}{"fuel": 5, "consumption": 10}, []deviceStep{
+			{at: time.Second, expected: 0, active: false},
+			{at: time.Second, field: ":fuel", value: 40, expected: 40, active: true},
+			{at: 2 * time.Second, expected: 30, active: true},
+		}},
+		{"Capacity", map[string]interface{}{"capacity": 50, "consumption": -10}, []deviceStep{
+			{at: time.Second, expected: 50, active: false},
+		}},
+	}
+	for _, c := range cases {
+		cfg := devices.Config{
+			Type:    "fueltank",
+			Options: c.options,
+		}
+		runDeviceSteps(t, c.name, cfg, ":fuel", c.steps)
+	}
+}
@@ -0,0 +1,105 @@
+package devices
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// hinge is a hinge that rotates towards a target-angle at a fixed speed.
+// Scripts set the target using the field hingetarget and can observe the current angle using the field hingeangle
+type hinge struct {
+	names fieldNames
+	lock  *sync.Mutex
+	// rotation speed in degrees per second
+	speed      float64
+	angle      float64
+	target     float64
+	lastUpdate time.Duration
+}
+
+// newHinge creates a hinge. Options: speed (degrees per second, default 45) and angle (the initial angle, default 0)
+func newHinge(cfg Config) (vm.Device, error) {
+	err := checkOptions(cfg, "speed", "angle")
+	if err != nil {
+		return nil, err
+	}
+	names, err := newFieldNames(cfg.Fields, "hingeangle", "hingetarget")
+	if err != nil {
+		return nil, err
+	}
+	speed, err := numberOption(cfg, "speed", 45)
+	if err != nil {
+		return nil, err
+	}
+	angle, err := numberOption(cfg, "angle", 0)
+	if err != nil {
+		return nil, err
+	}
+	return &hinge{
+		names:  names,
+		lock:   &sync.Mutex{},
+		speed:  speed,
+		angle:  angle,
+		target: angle,
+	}, nil
+}
+
+// Fields is needed to implement vm.Device
+func (h *hinge) Fields() map[string]*vm.Variable {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return map[string]*vm.Variable{
+		h.names.global("hingeangle"):  numberVariable(h.angle),
+		h.names.global("hingetarget"): numberVariable(h.target),
+	}
+}
+
+// OnWrite is needed to implement vm.Device
+func (h *hinge) OnWrite(field string, value *vm.Variable, now time.Duration) {
+	if !value.IsNumber() {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	switch h.names.local(field) {
+	case "hingetarget":
+		h.target = value.Number().Float64()
+	case "hingeangle":
+		h.angle = value.Number().Float64()
+	}
+}
+
+// Active is needed to implement vm.ActiveDevice
+func (h *hinge) Active() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.angle != h.target
+}
+
+// Update is needed to implement vm.Device
+func (h *hinge) Update(now time.Duration) map[string]*vm.Variable {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	elapsed := (now - h.lastUpdate).Seconds()
+	h.lastUpdate = now
+	if h.angle == h.target {
+		return nil
+	}
+	step := h.speed * elapsed
+	if h.angle < h.target {
+		h.angle += step
+		if h.angle > h.target {
+			h.angle = h.target
+		}
+	} else {
+		h.angle -= step
+		if h.angle < h.target {
+			h.angle = h.target
+		}
+	}
+	return map[string]*vm.Variable{
+		h.names.global("hingeangle"): numberVariable(h.angle),
+	}
+}
@@ -0,0 +1,95 @@
+package devices_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/devices"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// deviceStep advances the simulated time of a device and optionally writes a field afterwards, like a script would
+type deviceStep struct {
+	// the simulated time to update the device to
+	at time.Duration
+	// the field to write after updating. Empty for no write
+	field string
+	value float64
+	// the expected value of the checked field after the update
+	expected float64
+	// the expected result of Active() after the update
+	active bool
+}
+
+// runDeviceSteps creates the device from cfg, runs the steps and compares the value of the checked field after every step
+func runDeviceSteps(t *testing.T, name string, cfg devices.Config, checked string, steps []deviceStep) {
+	d, err := devices.Create(cfg)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	for i, step := range steps {
+		d.Update(step.at)
+		if step.field != "" {
+			value, _ := vm.VariableFromType(step.value)
+			d.OnWrite(step.field, value, step.at)
+		}
+		value := d.Fields()[checked]
+		if value == nil {
+			t.Fatalf("%s: The device has no field %s", name, checked)
+		}
+		if value.Number().Float64() != step.expected {
+			t.Errorf("%s, step %d: %s should be %v but is %s", name, i+1, checked, step.expected, value.Repr())
+		}
+		if active := d.(vm.ActiveDevice).Active(); active != step.active {
+			t.Errorf("%s, step %d: Active() should be %v but is %v", name, i+1, step.active, active)
+		}
+	}
+}
+
+func TestHinge(t *testing.T) {
+	cases := []struct {
+		name    string
+		options map[string]interface{}
+		steps   []deviceStep
+	}{
+		{"Resting", nil, []deviceStep{
+			{at: time.Second, expected: 0, active: false},
+		}},
+		{"Default speed", nil, []deviceStep{
+			{at: 0, field: ":hingetarget", value: 90, expected: 0, active: true},
+			{at: time.Second, expected: 45, active: true},
+			{at: 2 * time.Second, expected: 90, active: false},
+		}},
+		{"Custom speed", map[string]interface{}{"speed": 10}, []deviceStep{
+			{at: 0, field: ":hingetarget", value: 90, expected: 0, active: true},
+			{at: 200 * time.Millisecond, expected: 2, active: true},
+			{at: 3 * time.Second, expected: 30, active: true},
+		}},
+		{"Backwards", map[string]interface{}{"angle": 90}, []deviceStep{
+			{at: 0, field: ":hingetarget", value: 0, expected: 90, active: true},
+			{at: time.Second, expected: 45, active: true},
+		}},
+		{"Clamp at target", map[string]interface{}{"speed": 100}, []deviceStep{
+			{at: 0, field: ":hingetarget", value: 30, expected: 0, active: true},
+			{at: time.Second, expected: 30, active: false},
+			{at: 2 * time.Second, expected: 30, active: false},
+		}},
+		{"Clamp at target backwards", map[string]interface{}{"speed": 100, "angle": 30}, []deviceStep{
+			{at: 0, field: ":hingetarget", value: -20, expected: 30, active: true},
+			{at: time.Second, expected: -20, active: false},
+		}},
+		{"New target while moving", nil, []deviceStep{
+			{at: 0, field: ":hingetarget", value: 90, expected: 0, active: true},
+			{at: time.Second, expected: 45, active: true},
+			{at: time.Second, field: ":hingetarget", value: 0, expected: 45, active: true},
+			{at: 2 * time.Second, expected: 0, active: false},
+		}},
+	}
+	for _, c := range cases {
+		cfg := devices.Config{
+			Type:    "hinge",
+			Options: c.options,
+		}
+		runDeviceSteps(t, c.name, cfg, ":hingeangle", c.steps)
+	}
+}
@@ -0,0 +1,99 @@
+package devices
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// passive is a device whose fields are only changed by scripts. It does not react to writes or the passing of time.
+type passive struct {
+	initial map[string]*vm.Variable
+}
+
+// newPassive creates a passive device. defaults maps the default field-names to their initial values
+func newPassive(cfg Config, defaults map[string]*vm.Variable) (vm.Device, error) {
+	err := checkOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	locals := make([]string, 0, len(defaults))
+	for name := range defaults {
+		locals = append(locals, name)
+	}
+	names, err := newFieldNames(cfg.Fields, locals...)
+	if err != nil {
+		return nil, err
+	}
+	p := &passive{
+		initial: make(map[string]*vm.Variable, len(defaults)),
+	}
+	for name, value := range defaults {
+		p.initial[names.global(name)] = value
+	}
+	return p, nil
+}
+
+// newButton creates a button. The state of the button (0 or 1) is stored in the field buttonstate
+func newButton(cfg Config) (vm.Device, error) {
+	return newPassive(cfg, map[string]*vm.Variable{
+		"buttonstate": numberVariable(0),
+	})
+}
+
+// newLamp creates a lamp with the fields of a lamp in starbase
+func newLamp(cfg Config) (vm.Device, error) {
+	return newPassive(cfg, map[string]*vm.Variable{
+		"lampon":              numberVariable(0),
+		"lamplumens":          numberVariable(0),
+		"lampcolorhue":        numberVariable(0),
+		"lampcolorsaturation": numberVariable(0),
+		"lampcolorvalue":      numberVariable(0),
+		"lamprange":           numberVariable(0),
+	})
+}
+
+// newTextPanel creates a text-panel. The displayed text is stored in the field panelvalue
+func newTextPanel(cfg Config) (vm.Device, error) {
+	return newPassive(cfg, map[string]*vm.Variable{
+		"panelvalue": {Value: ""},
+	})
+}
+
+// newMemory creates a memory-chip. The fields of the chip and their initial values are defined by cfg.Values
+func newMemory(cfg Config) (vm.Device, error) {
+	if len(cfg.Fields) > 0 {
+		return nil, fmt.Errorf("The fields of a memory-chip can not be renamed. Change their names in 'values' instead")
+	}
+	if len(cfg.Values) == 0 {
+		return nil, fmt.Errorf("A memory-chip needs at least one field. Define its fields using 'values'")
+	}
+	defaults := make(map[string]*vm.Variable, len(cfg.Values))
+	for name, value := range cfg.Values {
+		variable, err := vm.VariableFromType(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value for field '%s': %s", name, err.Error())
+		}
+		defaults[strings.TrimPrefix(strings.ToLower(name), ":")] = variable
+	}
+	return newPassive(cfg, defaults)
+}
+
+// Fields is needed to implement vm.Device
+func (p *passive) Fields() map[string]*vm.Variable {
+	fields := make(map[string]*vm.Variable, len(p.initial))
+	for name, value := range p.initial {
+		fields[name] = value
+	}
+	return fields
+}
+
+// OnWrite is needed to implement vm.Device
+func (p *passive) OnWrite(field string, value *vm.Variable, now time.Duration) {}
+
+// Update is needed to implement vm.Device
+func (p *passive) Update(now time.Duration) map[string]*vm.Variable {
+	return nil
+}
@@ -57,6 +57,18 @@ func (c *Converter) GetVariableTranslations() map[string]string {
 	return c.varnameOptimizer.GetReversalTable()
 }
 
+// GetDefinitions returns the values of all definitions without placeholders (constants) by their lowercased name.
+// Only contains the definitions encountered during the last conversion
+func (c *Converter) GetDefinitions() map[string]ast.Expression {
+	defs := make(map[string]ast.Expression, len(c.definitions))
+	for name, def := range c.definitions {
+		if len(def.Placeholders) == 0 {
+			defs[name] = def.Value
+		}
+	}
+	return defs
+}
+
 // ConvertFile is a shortcut that loads a file from the file-system, parses it and directly convertes it.
 // mainfile is the path to the file on the disk.
 // All included are loaded relative to the mainfile.
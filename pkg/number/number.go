@@ -7,6 +7,9 @@ import (
 	"strings"
 )
 
+// ErrDivisionByZero is returned when dividing by zero or computing the modulus of zero
+var ErrDivisionByZero = fmt.Errorf("Division by 0")
+
 // Number is a fixed-point 3-digit number type
 type Number int64
 
@@ -115,7 +118,7 @@ func (n Number) Mul(m Number) Number {
 // Div divides two numbers
 func (n Number) Div(m Number) (Number, error) {
 	if m == 0 {
-		return Zero, fmt.Errorf("Division by 0")
+		return Zero, ErrDivisionByZero
 	}
 	return (n * scale) / m, nil
 }
@@ -136,7 +139,7 @@ func (n Number) Sqrt() Number {
 // Mod returns the modulus of the number
 func (n Number) Mod(m Number) (Number, error) {
 	if m == Zero {
-		return Zero, fmt.Errorf("Division by 0")
+		return Zero, ErrDivisionByZero
 	}
 	return n % m, nil
 }
@@ -223,6 +223,30 @@ func (p *Parser) Parse(prog string) (*ast.Program, error) {
 	return nil, p.Errors
 }
 
+// ParseExpressionString parses a single yolol-expression (e.g. the condition of a breakpoint)
+func (p *Parser) ParseExpressionString(expr string) (ast.Expression, error) {
+	p.Reset()
+	p.Tokenizer.Load(expr)
+	// Advance twice to fill CurrentToken and NextToken
+	p.Advance()
+	p.Advance()
+	parsed := p.This.ParseExpression()
+	if parsed == nil {
+		p.ErrorExpectedExpression("input")
+	} else {
+		for p.IsCurrentType(ast.TypeNewline) {
+			p.Advance()
+		}
+		if p.HasNext() {
+			p.ErrorString("Unexpected token after expression", "")
+		}
+	}
+	if len(p.Errors) == 0 {
+		return parsed, nil
+	}
+	return nil, p.Errors
+}
+
 // ParseProgram parses a programm-node
 func (p *Parser) ParseProgram() *ast.Program {
 	p.Log()
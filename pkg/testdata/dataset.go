@@ -28,13 +28,18 @@ if counter < 20 then goto 7 end
 `
 
 func ExecuteTestProgram(prog string) error {
+	return ExecuteTestProgramWithEngine(prog, vm.EngineInterpreter)
+}
+
+func ExecuteTestProgramWithEngine(prog string, engine int) error {
 	var err error
 
 	v, _ := vm.CreateFromSource(prog)
-	v.SetErrorHandler(vm.ErrorHandlerFunc(func(v *vm.VM, e error) bool {
+	v.SetEngine(engine)
+	v.SetErrorHandler(vm.ErrorHandlerFunc(func(v *vm.VM, e error) {
 		err = e
-		return true
 	}))
+	v.SetErrorMode(vm.ErrorModeAbortLine)
 
 	v.SetLineExecutedHandler(vm.TerminateOnDoneVar)
 	v.Resume()
@@ -0,0 +1,182 @@
+package testing
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// Checkpoint asserts the values of global variables at a given point during the run of a case.
+// Exactly one of Tick, At and Lines must be set
+type Checkpoint struct {
+	// The values are checked after all lines of the given tick have run (see Event.Tick)
+	Tick int
+	// The values are checked after all lines starting at (or before) the given simulated time have run (e.g. "6s")
+	At string
+	// The values are checked after the given number of lines has been executed by all chips together
+	Lines int
+	// The expected values of global variables
+	Outputs map[string]interface{}
+}
+
+// Expectation asserts that global variables reach the given values while the case is running
+type Expectation struct {
+	// The number of lines (executed by all chips together) within which the values must be reached
+	Within int
+	// The expected values of global variables
+	Outputs map[string]interface{}
+}
+
+// tickOrTime returns the simulated time described by either a tick or a duration (see Event)
+func tickOrTime(tick int, at string) (time.Duration, error) {
+	if (tick == 0) == (at == "") {
+		return 0, fmt.Errorf("Either a tick or a time (at) is required")
+	}
+	if at != "" {
+		return ParseDuration(at)
+	}
+	if tick < 1 {
+		return 0, fmt.Errorf("Invalid tick %d. The first tick is 1", tick)
+	}
+	return time.Duration(tick-1) * time.Second / vm.DefaultLinesPerSecond, nil
+}
+
+// validate returns an error if the checkpoint is not well-formed
+func (c Checkpoint) validate() error {
+	if c.Lines != 0 {
+		if c.Tick != 0 || c.At != "" {
+			return fmt.Errorf("A checkpoint needs either a tick, a time (at) or a number of lines")
+		}
+		if c.Lines < 0 {
+			return fmt.Errorf("Invalid number of lines for a checkpoint: %d", c.Lines)
+		}
+		return nil
+	}
+	_, err := tickOrTime(c.Tick, c.At)
+	return err
+}
+
+// String describes the point in the run the checkpoint refers to
+func (c Checkpoint) String() string {
+	if c.Lines != 0 {
+		return fmt.Sprintf("checkpoint after %d lines", c.Lines)
+	}
+	if c.At != "" {
+		return fmt.Sprintf("checkpoint at %s", c.At)
+	}
+	return fmt.Sprintf("checkpoint at tick %d", c.Tick)
+}
+
+// caseChecks evaluates the intermediate assertions (checkpoints, expectations and invariants) of a running case
+type caseChecks struct {
+	lock  *sync.Mutex
+	c     *Case
+	coord *vm.Coordinator
+	// the script-name of each vm. Used in error-messages
+	scripts map[*vm.VM]string
+	// the number of lines executed by all vms
+	lines int
+	// the checkpoints that have been checked
+	reached map[int]bool
+	// the expectations that have been fulfilled or failed
+	settled map[int]bool
+	// true once an invariant has been violated. Only the first violation is reported
+	violated bool
+	fails    []error
+}
+
+// newCaseChecks prepares the evaluation of the assertions of the case. Time-based checkpoints are scheduled on the coordinator,
+// relative to its current simulated time
+func newCaseChecks(c *Case, coord *vm.Coordinator, scripts map[*vm.VM]string) (*caseChecks, error) {
+	checks := &caseChecks{
+		lock:    &sync.Mutex{},
+		c:       c,
+		coord:   coord,
+		scripts: scripts,
+		reached: make(map[int]bool),
+		settled: make(map[int]bool),
+		fails:   make([]error, 0),
+	}
+	for i, cp := range c.Checkpoints {
+		if cp.Lines != 0 {
+			continue
+		}
+		at, err := tickOrTime(cp.Tick, cp.At)
+		if err != nil {
+			return nil, err
+		}
+		i := i
+		// the lines starting at the given time must run before the check
+		coord.CallAfter(coord.Now()+at, func() {
+			checks.lock.Lock()
+			defer checks.lock.Unlock()
+			checks.checkpoint(i)
+		})
+	}
+	return checks, nil
+}
+
+// checkpoint checks the checkpoint with the given index
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (cc *caseChecks) checkpoint(i int) {
+	cp := cc.c.Checkpoints[i]
+	cc.reached[i] = true
+	cc.fails = append(cc.fails, cc.c.checkVariables(cc.coord, cp.Outputs, cp.String())...)
+}
+
+// lineExecuted is called after a vm executed a line (or aborted it because of a runtime-error)
+func (cc *caseChecks) lineExecuted(v *vm.VM) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	cc.lines++
+
+	for i, cp := range cc.c.Checkpoints {
+		if cp.Lines == cc.lines {
+			cc.checkpoint(i)
+		}
+	}
+
+	for i, exp := range cc.c.Eventually {
+		if cc.settled[i] {
+			continue
+		}
+		fails := cc.c.checkVariables(cc.coord, exp.Outputs, fmt.Sprintf("expected within %d lines", exp.Within))
+		if len(fails) == 0 {
+			cc.settled[i] = true
+		} else if cc.lines >= exp.Within {
+			cc.settled[i] = true
+			cc.fails = append(cc.fails, fails...)
+		}
+	}
+
+	if !cc.violated && len(cc.c.Invariants) > 0 {
+		context := fmt.Sprintf("invariant violated at %s by %s:%d", cc.coord.Now(), cc.scripts[v], v.CurrentSourceLine())
+		fails := cc.c.checkVariables(cc.coord, cc.c.Invariants, context)
+		if len(fails) > 0 {
+			cc.violated = true
+			cc.fails = append(cc.fails, fails...)
+		}
+	}
+}
+
+// results returns the failed assertions. Must be called after the run has finished.
+// Checkpoints that have not been reached and pending expectations are reported as failures
+func (cc *caseChecks) results() []error {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	fails := make([]error, len(cc.fails))
+	copy(fails, cc.fails)
+	for i, cp := range cc.c.Checkpoints {
+		if !cc.reached[i] {
+			fails = append(fails, fmt.Errorf("Case '%s': The %s has not been reached", cc.c.Name, cp.String()))
+		}
+	}
+	for i, exp := range cc.c.Eventually {
+		if !cc.settled[i] {
+			fails = append(fails, cc.c.checkVariables(cc.coord, exp.Outputs, fmt.Sprintf("expected within %d lines", exp.Within))...)
+		}
+	}
+	return fails
+}
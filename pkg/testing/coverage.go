@@ -0,0 +1,441 @@
+package testing
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// BranchCoverage counts the outcomes of the condition of an if-statement
+type BranchCoverage struct {
+	// the position of the if-statement
+	Position ast.Position
+	// how often the condition has been true
+	Taken int
+	// how often the condition has been false
+	Skipped int
+}
+
+// Covered returns the number of outcomes (true and false) that have occured at least once
+func (b BranchCoverage) Covered() int {
+	covered := 0
+	if b.Taken > 0 {
+		covered++
+	}
+	if b.Skipped > 0 {
+		covered++
+	}
+	return covered
+}
+
+// FileCoverage contains the coverage of a single source-file
+type FileCoverage struct {
+	// the path of the source-file
+	Path string
+	// the number of executions per statement. Contains all statements of the file, including the never executed ones
+	Statements map[ast.Position]int
+	// the outcomes of all if-statements of the file
+	Branches map[ast.Position]*BranchCoverage
+	// the content of the file, if known. Otherwise the file is read from disk when needed
+	source *string
+}
+
+// CoverageSummary contains the number of total and covered statements and branches.
+// Every if-statement has two branches: the condition being true and the condition being false
+type CoverageSummary struct {
+	Statements        int
+	CoveredStatements int
+	Branches          int
+	CoveredBranches   int
+}
+
+// StatementPercent returns the percentage of covered statements
+func (s CoverageSummary) StatementPercent() float64 {
+	return percent(s.CoveredStatements, s.Statements)
+}
+
+// BranchPercent returns the percentage of covered branches
+func (s CoverageSummary) BranchPercent() float64 {
+	return percent(s.CoveredBranches, s.Branches)
+}
+
+func percent(covered int, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(covered) * 100 / float64(total)
+}
+
+// Coverage collects statement- and branch-coverage of the scripts run by tests.
+// The same coverage can be used for multiple tests, the results are aggregated per source-file.
+// For nolol-scripts the coverage refers to the lines of the .nolol files (including included files)
+type Coverage struct {
+	lock  *sync.Mutex
+	files map[string]*FileCoverage
+}
+
+// NewCoverage returns a new, empty coverage
+func NewCoverage() *Coverage {
+	return &Coverage{
+		lock:  &sync.Mutex{},
+		files: make(map[string]*FileCoverage),
+	}
+}
+
+// Files returns the coverage of all files, ordered by path
+func (c *Coverage) Files() []FileCoverage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	files := make([]FileCoverage, 0, len(c.files))
+	for _, file := range c.files {
+		copied := FileCoverage{
+			Path:       file.Path,
+			Statements: make(map[ast.Position]int, len(file.Statements)),
+			Branches:   make(map[ast.Position]*BranchCoverage, len(file.Branches)),
+			source:     file.source,
+		}
+		for pos, count := range file.Statements {
+			copied.Statements[pos] = count
+		}
+		for pos, branch := range file.Branches {
+			b := *branch
+			copied.Branches[pos] = &b
+		}
+		files = append(files, copied)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// Summary returns the summary for the file
+func (f FileCoverage) Summary() CoverageSummary {
+	s := CoverageSummary{
+		Statements: len(f.Statements),
+		Branches:   2 * len(f.Branches),
+	}
+	for _, count := range f.Statements {
+		if count > 0 {
+			s.CoveredStatements++
+		}
+	}
+	for _, branch := range f.Branches {
+		s.CoveredBranches += branch.Covered()
+	}
+	return s
+}
+
+// Summary returns the summary for all files
+func (c *Coverage) Summary() CoverageSummary {
+	total := CoverageSummary{}
+	for _, file := range c.Files() {
+		s := file.Summary()
+		total.Statements += s.Statements
+		total.CoveredStatements += s.CoveredStatements
+		total.Branches += s.Branches
+		total.CoveredBranches += s.CoveredBranches
+	}
+	return total
+}
+
+// sortedPositions returns the positions of the file's statements (or branches, if branches is true) in source-order
+func (f FileCoverage) sortedPositions(branches bool) []ast.Position {
+	positions := make([]ast.Position, 0, len(f.Statements))
+	if branches {
+		for pos := range f.Branches {
+			positions = append(positions, pos)
+		}
+	} else {
+		for pos := range f.Statements {
+			positions = append(positions, pos)
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Line != positions[j].Line {
+			return positions[i].Line < positions[j].Line
+		}
+		return positions[i].Coloumn < positions[j].Coloumn
+	})
+	return positions
+}
+
+// lineCounts returns the number of executions per line. A line counts as executed as often as its most executed statement
+func (f FileCoverage) lineCounts() map[int]int {
+	lines := make(map[int]int)
+	for pos, count := range f.Statements {
+		if current, exists := lines[pos.Line]; !exists || count > current {
+			lines[pos.Line] = count
+		}
+	}
+	return lines
+}
+
+// WriteSummary writes a human-readable summary to w. It lists the coverage per file
+// and all if-statements whose condition has never been true or never been false
+func (c *Coverage) WriteSummary(w io.Writer) error {
+	files := c.Files()
+	for _, file := range files {
+		s := file.Summary()
+		_, err := fmt.Fprintf(w, "%s: statements %d/%d (%.1f%%), branches %d/%d (%.1f%%)\n", file.Path,
+			s.CoveredStatements, s.Statements, s.StatementPercent(), s.CoveredBranches, s.Branches, s.BranchPercent())
+		if err != nil {
+			return err
+		}
+	}
+	s := c.Summary()
+	_, err := fmt.Fprintf(w, "Total: statements %d/%d (%.1f%%), branches %d/%d (%.1f%%)\n",
+		s.CoveredStatements, s.Statements, s.StatementPercent(), s.CoveredBranches, s.Branches, s.BranchPercent())
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		for _, pos := range file.sortedPositions(true) {
+			branch := file.Branches[pos]
+			var missing string
+			switch {
+			case branch.Taken == 0 && branch.Skipped == 0:
+				missing = "never evaluated"
+			case branch.Taken == 0:
+				missing = "never true"
+			case branch.Skipped == 0:
+				missing = "never false"
+			default:
+				continue
+			}
+			_, err := fmt.Fprintf(w, "%s:%d:%d: condition %s\n", file.Path, pos.Line, pos.Coloumn, missing)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteLCOV writes the coverage in the lcov tracefile-format to w.
+// For every if-statement the branches 0 (condition true) and 1 (condition false) are reported
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString("TN:\n")
+	for _, file := range c.Files() {
+		fmt.Fprintf(b, "SF:%s\n", file.Path)
+		lines := file.lineCounts()
+		linenrs := make([]int, 0, len(lines))
+		for line := range lines {
+			linenrs = append(linenrs, line)
+		}
+		sort.Ints(linenrs)
+
+		// the number of the if-statement in its line is used as block-number
+		block := 0
+		lastLine := 0
+		for _, pos := range file.sortedPositions(true) {
+			if pos.Line != lastLine {
+				block = 0
+				lastLine = pos.Line
+			}
+			branch := file.Branches[pos]
+			taken, skipped := "-", "-"
+			if branch.Taken > 0 || branch.Skipped > 0 {
+				taken = fmt.Sprint(branch.Taken)
+				skipped = fmt.Sprint(branch.Skipped)
+			}
+			fmt.Fprintf(b, "BRDA:%d,%d,0,%s\n", pos.Line, block, taken)
+			fmt.Fprintf(b, "BRDA:%d,%d,1,%s\n", pos.Line, block, skipped)
+			block++
+		}
+		s := file.Summary()
+		fmt.Fprintf(b, "BRF:%d\n", s.Branches)
+		fmt.Fprintf(b, "BRH:%d\n", s.CoveredBranches)
+
+		hit := 0
+		for _, line := range linenrs {
+			fmt.Fprintf(b, "DA:%d,%d\n", line, lines[line])
+			if lines[line] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(b, "LF:%d\n", len(linenrs))
+		fmt.Fprintf(b, "LH:%d\n", hit)
+		b.WriteString("end_of_record\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes a html-page to w that shows the source-code of all files with the coverage of every line.
+// Files whose content is not known are read from disk
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 8px; white-space: pre; }
+.covered { background-color: #c8f0c8; }
+.partial { background-color: #f8f0b0; }
+.uncovered { background-color: #f8c8c8; }
+.count, .line { text-align: right; color: #666; }
+</style>
+</head>
+<body>
+`)
+	s := c.Summary()
+	fmt.Fprintf(b, "<h1>Coverage</h1>\n<p>Statements: %d/%d (%.1f%%), Branches: %d/%d (%.1f%%)</p>\n",
+		s.CoveredStatements, s.Statements, s.StatementPercent(), s.CoveredBranches, s.Branches, s.BranchPercent())
+
+	for _, file := range c.Files() {
+		var source string
+		if file.source != nil {
+			source = *file.source
+		} else {
+			content, err := ioutil.ReadFile(file.Path)
+			if err != nil {
+				return err
+			}
+			source = string(content)
+		}
+
+		fs := file.Summary()
+		fmt.Fprintf(b, "<h2>%s</h2>\n<p>Statements: %d/%d (%.1f%%), Branches: %d/%d (%.1f%%)</p>\n<table>\n",
+			html.EscapeString(file.Path), fs.CoveredStatements, fs.Statements, fs.StatementPercent(), fs.CoveredBranches, fs.Branches, fs.BranchPercent())
+
+		lines := file.lineCounts()
+		branches := make(map[int][]*BranchCoverage)
+		for _, pos := range file.sortedPositions(true) {
+			branches[pos.Line] = append(branches[pos.Line], file.Branches[pos])
+		}
+
+		for i, text := range strings.Split(strings.TrimRight(source, "\n"), "\n") {
+			linenr := i + 1
+			class := ""
+			count := ""
+			if executions, exists := lines[linenr]; exists {
+				count = fmt.Sprint(executions)
+				class = "covered"
+				if executions == 0 {
+					class = "uncovered"
+				}
+				for pos, stmtExecutions := range file.Statements {
+					if pos.Line == linenr && stmtExecutions == 0 && executions > 0 {
+						class = "partial"
+					}
+				}
+			}
+			notes := make([]string, 0)
+			for _, branch := range branches[linenr] {
+				if branch.Covered() < 2 {
+					if class == "covered" {
+						class = "partial"
+					}
+				}
+				notes = append(notes, fmt.Sprintf("true: %d, false: %d", branch.Taken, branch.Skipped))
+			}
+			fmt.Fprintf(b, "<tr class=\"%s\"><td class=\"line\">%d</td><td class=\"count\">%s</td><td>%s</td><td>%s</td></tr>\n",
+				class, linenr, count, html.EscapeString(strings.TrimRight(text, "\r")), html.EscapeString(strings.Join(notes, "; ")))
+		}
+		b.WriteString("</table>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// file returns the coverage for the file with the given path, creating it if needed
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (c *Coverage) file(path string) *FileCoverage {
+	file, exists := c.files[path]
+	if !exists {
+		file = &FileCoverage{
+			Path:       path,
+			Statements: make(map[ast.Position]int),
+			Branches:   make(map[ast.Position]*BranchCoverage),
+		}
+		c.files[path] = file
+	}
+	return file
+}
+
+// sourceFile returns the path of the source-file containing pos. script is the path of the script the position belongs to.
+// Positions inside files included by nolol-scripts contain the path of the included file (relative to the script)
+func sourceFile(script string, pos ast.Position) string {
+	if pos.File == "" {
+		return script
+	}
+	if filepath.IsAbs(pos.File) {
+		return pos.File
+	}
+	return filepath.Join(filepath.Dir(script), pos.File)
+}
+
+// addProgram registers all statements of the program with an execution-count of 0.
+// script is the path of the script and source its content (used if the script is not stored on disk)
+func (c *Coverage) addProgram(script string, prog *ast.Program, source string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.file(script).source = &source
+	var add func(stmts []ast.Statement)
+	add = func(stmts []ast.Statement) {
+		for _, stmt := range stmts {
+			pos := stmt.Start()
+			// statements generated by the nolol-converter (like the goto at the end of the program) have no coloumn
+			if pos.Coloumn == 0 {
+				continue
+			}
+			file := c.file(sourceFile(script, pos))
+			pos.File = ""
+			if _, exists := file.Statements[pos]; !exists {
+				file.Statements[pos] = 0
+			}
+			if ifstmt, isIf := stmt.(*ast.IfStatement); isIf {
+				if _, exists := file.Branches[pos]; !exists {
+					file.Branches[pos] = &BranchCoverage{Position: pos}
+				}
+				add(ifstmt.IfBlock)
+				add(ifstmt.ElseBlock)
+			}
+		}
+	}
+	for _, line := range prog.Lines {
+		add(line.Statements)
+	}
+}
+
+// addProfile adds the executions counted in the profile. The script-names used in the profile must be the paths of the scripts
+func (c *Coverage) addProfile(p *vm.Profile) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, stmt := range p.Statements() {
+		pos := stmt.Position
+		if pos.Coloumn == 0 {
+			continue
+		}
+		file := c.file(sourceFile(stmt.Script, pos))
+		pos.File = ""
+		file.Statements[pos] += stmt.Executions
+	}
+	for _, branch := range p.Branches() {
+		pos := branch.Position
+		file := c.file(sourceFile(branch.Script, pos))
+		pos.File = ""
+		b, exists := file.Branches[pos]
+		if !exists {
+			b = &BranchCoverage{Position: pos}
+			file.Branches[pos] = b
+		}
+		b.Taken += branch.Taken
+		b.Skipped += branch.Skipped
+	}
+}
@@ -0,0 +1,82 @@
+package testing
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TestFileSuffix is the suffix of files that are found by FindTestFiles()
+const TestFileSuffix = "_test.yaml"
+
+// FindTestFiles resolves the given arguments to a list of test-files.
+// Files are used as they are. For a directory, all test-files (files ending in TestFileSuffix) in this directory are used.
+// Arguments ending in "/..." (like "./...") search the directory and all its sub-directories.
+// Directories starting with a "." are skipped while searching.
+// Files are returned in the order of the arguments (found files sorted by path), without duplicates
+func FindTestFiles(args []string) ([]string, error) {
+	files := make([]string, 0, len(args))
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if !seen[filepath.Clean(file)] {
+			seen[filepath.Clean(file)] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, arg := range args {
+		recursive := false
+		if arg == "..." || strings.HasSuffix(arg, "/...") || strings.HasSuffix(arg, `\...`) {
+			recursive = true
+			arg = strings.TrimRight(strings.TrimSuffix(arg, "..."), `/\`)
+			if arg == "" {
+				arg = "."
+			}
+		}
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(arg)
+			continue
+		}
+		found := make([]string, 0)
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != arg && (!recursive || strings.HasPrefix(info.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(info.Name(), TestFileSuffix) {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		for _, file := range found {
+			add(file)
+		}
+	}
+	return files, nil
+}
+
+// SelectCases removes all cases whose name does not match the given regular expression
+func (t *Test) SelectCases(pattern *regexp.Regexp) {
+	selected := make([]Case, 0, len(t.Cases))
+	for _, c := range t.Cases {
+		if pattern.MatchString(c.Name) {
+			selected = append(selected, c)
+		}
+	}
+	t.Cases = selected
+}
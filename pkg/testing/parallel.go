@@ -0,0 +1,69 @@
+package testing
+
+import (
+	"sync"
+)
+
+// Pool limits the number of cases that run at the same time. Every case runs on its own coordinator,
+// so cases do not influence each other. A pool can be shared by multiple tests (see Test.Pool)
+type Pool struct {
+	slots chan struct{}
+}
+
+// NewPool returns a pool that runs up to size cases at the same time. A size < 1 is treated as 1
+func NewPool(size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		slots: make(chan struct{}, size),
+	}
+}
+
+// do runs f once a slot of the pool is free
+func (p *Pool) do(f func()) {
+	p.slots <- struct{}{}
+	defer func() {
+		<-p.slots
+	}()
+	f()
+}
+
+// runCases calls run for every case and returns the errors of all cases in the order of the cases.
+// callback (if not nil) is called for every case, in the order of the cases and before the errors of the case are collected.
+// If the test has a pool, the cases are run in parallel. Otherwise (or if a trace is recorded) they are run one after another
+func (t Test) runCases(callback func(Case), run func(casenr int) []error) []error {
+	results := make([][]error, len(t.Cases))
+	// the trace records the lines in the order of execution. Mixing multiple cases would make it useless
+	if t.Pool == nil || t.Trace != nil {
+		for i := range t.Cases {
+			if callback != nil {
+				callback(t.Cases[i])
+			}
+			results[i] = run(i)
+		}
+	} else {
+		wg := &sync.WaitGroup{}
+		for i := range t.Cases {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				t.Pool.do(func() {
+					results[i] = run(i)
+				})
+			}(i)
+		}
+		wg.Wait()
+		if callback != nil {
+			for _, c := range t.Cases {
+				callback(c)
+			}
+		}
+	}
+
+	fails := make([]error, 0)
+	for _, casefails := range results {
+		fails = append(fails, casefails...)
+	}
+	return fails
+}
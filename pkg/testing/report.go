@@ -0,0 +1,455 @@
+package testing
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CaseResult is the result of running a single test-case
+type CaseResult struct {
+	// the name of the case
+	Name string
+	// the real time it took to run the case
+	Duration time.Duration
+	// the simulated time the scripts ran for
+	SimulatedTime time.Duration
+	// the number of lines executed by all scripts
+	ExecutedLines int
+	// the reasons why the case failed. Empty if the case passed
+	Fails []error
+	// the position of the case in the test-file
+	index int
+}
+
+// Passed returns true if the case did not fail
+func (r CaseResult) Passed() bool {
+	return len(r.Fails) == 0
+}
+
+// FileResult contains the results of all cases of a test-file
+type FileResult struct {
+	// the path of the test-file
+	Path string
+	// the error that prevented the test-file from running (e.g. a syntax-error), if any
+	Error error
+	// the results of the cases, in the order of the test-file
+	Cases []CaseResult
+}
+
+// Passed returns true if the file could be run and none of its cases failed
+func (r FileResult) Passed() bool {
+	return r.Error == nil && r.Failures() == 0
+}
+
+// Failures returns the number of failed cases
+func (r FileResult) Failures() int {
+	failures := 0
+	for _, c := range r.Cases {
+		if !c.Passed() {
+			failures++
+		}
+	}
+	return failures
+}
+
+// Duration returns the real time it took to run all cases
+func (r FileResult) Duration() time.Duration {
+	var d time.Duration
+	for _, c := range r.Cases {
+		d += c.Duration
+	}
+	return d
+}
+
+// ReportFormats are the formats a report can be written in (see Report.Write())
+var ReportFormats = []string{"junit", "tap", "json"}
+
+// Report collects the results of test-runs and writes them in machine-readable formats (JUnit-XML, TAP or JSON).
+// Set Test.Report to record the results of a test into the report
+type Report struct {
+	lock  *sync.Mutex
+	dir   string
+	files map[string]*FileResult
+}
+
+// caseStats are measured while running a case
+type caseStats struct {
+	duration  time.Duration
+	simulated time.Duration
+	lines     int
+}
+
+// add adds the stats of another run of the same case
+func (s *caseStats) add(other caseStats) {
+	s.duration += other.duration
+	s.simulated += other.simulated
+	s.lines += other.lines
+}
+
+// NewReport returns a new, empty report. The paths of the test-files are written relative to dir (if possible)
+func NewReport(dir string) *Report {
+	return &Report{
+		lock:  &sync.Mutex{},
+		dir:   dir,
+		files: make(map[string]*FileResult),
+	}
+}
+
+// file returns the results of the given test-file
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (r *Report) file(path string) *FileResult {
+	result, exists := r.files[path]
+	if !exists {
+		result = &FileResult{
+			Path:  path,
+			Cases: make([]CaseResult, 0),
+		}
+		r.files[path] = result
+	}
+	return result
+}
+
+// AddFileError records that the given test-file could not be run
+func (r *Report) AddFileError(path string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.file(path).Error = err
+}
+
+// addCase records the result of the case with the given number. Does nothing if the report is nil
+func (r *Report) addCase(t Test, casenr int, stats caseStats, fails []error) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	file := r.file(t.Path)
+	file.Cases = append(file.Cases, CaseResult{
+		Name:          t.Cases[casenr].Name,
+		Duration:      stats.duration,
+		SimulatedTime: stats.simulated,
+		ExecutedLines: stats.lines,
+		Fails:         fails,
+		index:         casenr,
+	})
+	sort.SliceStable(file.Cases, func(i, j int) bool {
+		return file.Cases[i].index < file.Cases[j].index
+	})
+}
+
+// Files returns the results of all test-files, ordered by path
+func (r *Report) Files() []FileResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	files := make([]FileResult, 0, len(r.files))
+	for _, file := range r.files {
+		result := *file
+		result.Path = r.displayPath(file.Path)
+		result.Cases = make([]CaseResult, len(file.Cases))
+		copy(result.Cases, file.Cases)
+		files = append(files, result)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// displayPath returns the path relative to the directory of the report, if possible
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (r *Report) displayPath(path string) string {
+	if r.dir == "" {
+		return path
+	}
+	rel, err := filepath.Rel(r.dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Write writes the report in the given format ("junit", "tap" or "json")
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "junit":
+		return r.WriteJUnit(w)
+	case "tap":
+		return r.WriteTAP(w)
+	case "json":
+		return r.WriteJSON(w)
+	}
+	return fmt.Errorf("Unknown report-format '%s'. Available formats are: %s", format, strings.Join(ReportFormats, ", "))
+}
+
+// WriteSummary writes a human-readable summary of the report: the number of passed and failed cases
+// and a list of all failed cases and test-files that could not be run
+func (r *Report) WriteSummary(w io.Writer) error {
+	files := r.Files()
+	cases := 0
+	failed := 0
+	for _, file := range files {
+		cases += len(file.Cases)
+		failed += file.Failures()
+	}
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%d test-files, %d cases: %d passed, %d failed\n", len(files), cases, cases-failed, failed)
+	for _, file := range files {
+		if file.Error != nil {
+			fmt.Fprintf(sb, "Error: %s could not be run\n", file.Path)
+		}
+		for _, c := range file.Cases {
+			if !c.Passed() {
+				fmt.Fprintf(sb, "Failed: %s: %s\n", file.Path, c.Name)
+			}
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// seconds formats a duration as seconds, like it is used in JUnit-reports
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// milliseconds returns the duration in milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// joinErrors returns the messages of the errors, one per line
+func joinErrors(errs []error) string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	Classname  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitFailure   `xml:"failure,omitempty"`
+	Error      *junitFailure   `xml:"error,omitempty"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// WriteJUnit writes the report as JUnit-XML. Every test-file is a testsuite and every case a testcase.
+// A test-file that could not be run is reported as a testcase with an error
+func (r *Report) WriteJUnit(w io.Writer) error {
+	out := junitTestSuites{
+		Suites: make([]junitTestSuite, 0),
+	}
+	var total time.Duration
+	for _, file := range r.Files() {
+		suite := junitTestSuite{
+			Name:      file.Path,
+			Tests:     len(file.Cases),
+			Failures:  file.Failures(),
+			Time:      seconds(file.Duration()),
+			TestCases: make([]junitTestCase, 0, len(file.Cases)),
+		}
+		if file.Error != nil {
+			suite.Tests++
+			suite.Errors++
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				Name:      "load",
+				Classname: file.Path,
+				Time:      seconds(0),
+				Error: &junitFailure{
+					Message: file.Error.Error(),
+					Type:    "error",
+					Text:    file.Error.Error(),
+				},
+			})
+		}
+		for _, c := range file.Cases {
+			tc := junitTestCase{
+				Name:      c.Name,
+				Classname: file.Path,
+				Time:      seconds(c.Duration),
+				Properties: []junitProperty{
+					{Name: "executed_lines", Value: strconv.Itoa(c.ExecutedLines)},
+					{Name: "simulated_time", Value: c.SimulatedTime.String()},
+				},
+			}
+			if !c.Passed() {
+				tc.Failure = &junitFailure{
+					Message: c.Fails[0].Error(),
+					Type:    "failure",
+					Text:    joinErrors(c.Fails),
+				}
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		out.Tests += suite.Tests
+		out.Failures += suite.Failures
+		out.Errors += suite.Errors
+		total += file.Duration()
+		out.Suites = append(out.Suites, suite)
+	}
+	out.Time = seconds(total)
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(out)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// WriteTAP writes the report in the Test Anything Protocol (version 13). Every case is a test-point.
+// A test-file that could not be run is reported as a failed test-point
+func (r *Report) WriteTAP(w io.Writer) error {
+	files := r.Files()
+	count := 0
+	for _, file := range files {
+		count += len(file.Cases)
+		if file.Error != nil {
+			count++
+		}
+	}
+	sb := &strings.Builder{}
+	sb.WriteString("TAP version 13\n")
+	fmt.Fprintf(sb, "1..%d\n", count)
+	nr := 0
+	for _, file := range files {
+		if file.Error != nil {
+			nr++
+			fmt.Fprintf(sb, "not ok %d - %s\n", nr, file.Path)
+			sb.WriteString("  ---\n")
+			fmt.Fprintf(sb, "  message: %s\n", strconv.Quote(file.Error.Error()))
+			sb.WriteString("  ...\n")
+		}
+		for _, c := range file.Cases {
+			nr++
+			status := "ok"
+			if !c.Passed() {
+				status = "not ok"
+			}
+			fmt.Fprintf(sb, "%s %d - %s: %s\n", status, nr, file.Path, c.Name)
+			sb.WriteString("  ---\n")
+			fmt.Fprintf(sb, "  duration_ms: %s\n", strconv.FormatFloat(milliseconds(c.Duration), 'f', 3, 64))
+			fmt.Fprintf(sb, "  simulated_time_ms: %s\n", strconv.FormatFloat(milliseconds(c.SimulatedTime), 'f', -1, 64))
+			fmt.Fprintf(sb, "  executed_lines: %d\n", c.ExecutedLines)
+			if !c.Passed() {
+				sb.WriteString("  failures:\n")
+				for _, fail := range c.Fails {
+					fmt.Fprintf(sb, "    - %s\n", strconv.Quote(fail.Error()))
+				}
+			}
+			sb.WriteString("  ...\n")
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// jsonCaseResult is the json-representation of a CaseResult
+type jsonCaseResult struct {
+	Name            string   `json:"name"`
+	Passed          bool     `json:"passed"`
+	DurationMs      float64  `json:"duration_ms"`
+	SimulatedTimeMs float64  `json:"simulated_time_ms"`
+	ExecutedLines   int      `json:"executed_lines"`
+	Failures        []string `json:"failures"`
+}
+
+// jsonFileResult is the json-representation of a FileResult
+type jsonFileResult struct {
+	Path   string           `json:"path"`
+	Passed bool             `json:"passed"`
+	Error  string           `json:"error,omitempty"`
+	Cases  []jsonCaseResult `json:"cases"`
+}
+
+// jsonReport is the json-representation of a Report
+type jsonReport struct {
+	Passed bool             `json:"passed"`
+	Tests  int              `json:"tests"`
+	Failed int              `json:"failed"`
+	Files  []jsonFileResult `json:"files"`
+}
+
+// WriteJSON writes the report as a single json-object
+func (r *Report) WriteJSON(w io.Writer) error {
+	out := jsonReport{
+		Passed: true,
+		Files:  make([]jsonFileResult, 0),
+	}
+	for _, file := range r.Files() {
+		jsonFile := jsonFileResult{
+			Path:   file.Path,
+			Passed: file.Passed(),
+			Cases:  make([]jsonCaseResult, len(file.Cases)),
+		}
+		if file.Error != nil {
+			jsonFile.Error = file.Error.Error()
+		}
+		for i, c := range file.Cases {
+			failures := make([]string, len(c.Fails))
+			for j, fail := range c.Fails {
+				failures[j] = fail.Error()
+			}
+			jsonFile.Cases[i] = jsonCaseResult{
+				Name:            c.Name,
+				Passed:          c.Passed(),
+				DurationMs:      milliseconds(c.Duration),
+				SimulatedTimeMs: milliseconds(c.SimulatedTime),
+				ExecutedLines:   c.ExecutedLines,
+				Failures:        failures,
+			}
+		}
+		out.Passed = out.Passed && file.Passed()
+		out.Tests += len(file.Cases)
+		out.Failed += file.Failures()
+		out.Files = append(out.Files, jsonFile)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
+	"github.com/dbaumgarten/yodk/pkg/devices"
 	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
 	"github.com/dbaumgarten/yodk/pkg/vm"
 )
 
@@ -25,11 +29,54 @@ type Test struct {
 	Cases []Case
 	// Maximum number of lines to run from the script (0=infinite)
 	MaxLines int
+	// Amount of simulated game-time to run the scripts for (e.g. "12s" or "1m30s"). A plain number is interpreted as seconds
+	RunFor string
+	// The speed of the chips running the scripts, in lines per second. Keys are the script-names.
+	// Scripts without an entry run at the default speed of 5 lines per second
+	LinesPerSecond map[string]float64
 	// Stop when is a map from global variable-name to value
 	// Execution is stopped when at least one of the listed variables is equal to the value
 	StopWhen map[string]interface{}
 	// When true, ignore runtime errors during testing
 	IgnoreErrs bool
+	// How the chips react to runtime-errors that are ignored (see IgnoreErrs): "abortline" (the default) aborts the
+	// current line and continues with the next line (like in the game), "halt" stops the chip.
+	// Without IgnoreErrs, every runtime-error stops the case and makes it fail and ErrorMode must not be set
+	ErrorMode string
+	// The engine that executes the scripts: "interpreter" (the default) or "compiled".
+	// The compiled engine is faster for long-running tests and behaves exactly like the interpreter
+	Engine string
+	// When true, a case ends as soon as all chips have become idle (no variable changes anymore and the chips repeat
+	// the same lines). If the case fails, the idle chips are reported as the first error
+	DetectIdle bool
+	// Path to a snapshot-file (relative to the test-file). If set, every case starts from the state in the snapshot.
+	// Inputs of the cases are applied after restoring the snapshot. The simulated time continues at the time of the snapshot,
+	// durations and ticks in the test (runfor, events, checkpoints) count from there.
+	Snapshot string
+	// Simulated devices (buttons, lamps, hinges ...) whose fields are available to the scripts as global variables.
+	// Devices are connected after restoring the snapshot and before applying the inputs of the cases
+	Devices []devices.Config
+	// The data-networks each script is connected to. Keys are the script-names.
+	// Scripts without an entry are connected to the default network. Globals of other networks are addressed
+	// in inputs, outputs and stop-conditions as "<network>:<variable>"
+	Networks map[string][]string
+	// Bridges forward selected fields between networks
+	Bridges []vm.Bridge
+	// Aliases for the global variables used by the scripts. Keys are script-names, values map the names used in the
+	// script to the names of the accessed globals (e.g. "a: fuellevel" makes the script's :a access :fuellevel)
+	Aliases map[string]map[string]string
+	// If set, all lines executed by the cases are recorded into this trace. Can not be set in the test-file
+	Trace *vm.Trace `yaml:"-"`
+	// If set, all lines executed by the cases are counted in this profile. Can not be set in the test-file
+	Profile *vm.Profile `yaml:"-"`
+	// If set, the statement- and branch-coverage of the scripts is collected into this coverage.
+	// Can not be set in the test-file and can not be used together with Profile
+	Coverage *Coverage `yaml:"-"`
+	// If set, the result of every case is recorded into this report. Can not be set in the test-file
+	Report *Report `yaml:"-"`
+	// If set, the cases are run in parallel, limited by the pool. Cases are always run one after another
+	// when a trace is recorded. Can not be set in the test-file
+	Pool *Pool `yaml:"-"`
 }
 
 // Case defines inputs and expected outputs for a run
@@ -42,6 +89,32 @@ type Case struct {
 	Outputs map[string]interface{}
 	// The same as Script.StopWhen. Both are merged together so this can be used to override/extend the script stop-conditions
 	StopWhen map[string]interface{}
+	// Overrides Test.RunFor for this case
+	RunFor string
+	// Changes of global variables during the run (like pressing and releasing a button)
+	Events []Event
+	// Assertions about the values of global variables at given points during the run
+	Checkpoints []Checkpoint
+	// Assertions about values global variables must reach within a number of lines
+	Eventually []Expectation
+	// Values of global variables that must hold after every executed line
+	Invariants map[string]interface{}
+}
+
+// Event sets global variables at a given point in simulated time during the run of a case
+type Event struct {
+	// The tick at which the variables are set. The first lines of the chips run at tick 1.
+	// A tick lasts as long as one line of a chip running at the default speed (200ms)
+	Tick int
+	// The simulated time at which the variables are set (e.g. "6s"). Can be used instead of Tick
+	At string
+	// The values of the global variables to set
+	Inputs map[string]interface{}
+}
+
+// Time returns the simulated time at which the event happens
+func (e Event) Time() (time.Duration, error) {
+	return tickOrTime(e.Tick, e.At)
 }
 
 // CaseRunner represents a prepared test-case that is ready to run
@@ -49,13 +122,18 @@ type CaseRunner struct {
 	Coordinator     *vm.Coordinator
 	VMs             []*vm.VM
 	VarTranslations []map[string]string
-	Test            *Test
-	Case            *Case
-	StopConditions  map[string]*vm.Variable
+	// the constants defined in nolol-scripts. Used to evaluate expressions while debugging
+	Definitions    []map[string]ast.Expression
+	Test           *Test
+	Case           *Case
+	StopConditions map[string]*vm.Variable
+	// evaluates the checkpoints, expectations and invariants of the case
+	checks *caseChecks
 }
 
 func prefixVarname(inp string) string {
-	if !strings.HasPrefix(inp, ":") {
+	// names like "engine:fuel" refer to a variable on a specific network
+	if !strings.Contains(inp, ":") {
 		return ":" + inp
 	}
 	return inp
@@ -70,19 +148,100 @@ func Parse(file []byte, path string) (Test, error) {
 		return test, fmt.Errorf("The provided test-file is invalid: %s", err.Error())
 	}
 	test.Path = path
-	// set a default for MaxLines
-	if test.MaxLines == 0 {
+	// set a default for MaxLines. If the test is limited by time, there is no need for a line-limit
+	if test.MaxLines == 0 && test.RunFor == "" {
 		test.MaxLines = 2000
 	}
-	// If there are no stop-conditions, set a default
-	if len(test.StopWhen) == 0 {
-		test.StopWhen = map[string]interface{}{
-			":done": 1,
+	_, err = ParseDuration(test.RunFor)
+	if err != nil {
+		return test, err
+	}
+	for _, c := range test.Cases {
+		_, err = ParseDuration(c.RunFor)
+		if err != nil {
+			return test, fmt.Errorf("Case '%s': %s", c.Name, err.Error())
+		}
+		for _, e := range c.Events {
+			_, err = e.Time()
+			if err != nil {
+				return test, fmt.Errorf("Case '%s': Invalid event: %s", c.Name, err.Error())
+			}
+		}
+		for _, cp := range c.Checkpoints {
+			err = cp.validate()
+			if err != nil {
+				return test, fmt.Errorf("Case '%s': Invalid checkpoint: %s", c.Name, err.Error())
+			}
+		}
+		for _, exp := range c.Eventually {
+			if exp.Within <= 0 {
+				return test, fmt.Errorf("Case '%s': Every expectation needs a number of lines (within)", c.Name)
+			}
+		}
+	}
+	mode, err := vm.ParseErrorMode(test.ErrorMode)
+	if err != nil {
+		return test, err
+	}
+	if _, err := vm.ParseEngine(test.Engine); err != nil {
+		return test, err
+	}
+	if test.ErrorMode != "" && !test.IgnoreErrs {
+		return test, fmt.Errorf("The error-mode can only be set together with ignoreerrs. Without it, every runtime-error makes the case fail")
+	}
+	if mode == vm.ErrorModePause {
+		return test, fmt.Errorf("The error-mode 'pause' can only be used when debugging")
+	}
+	for script := range test.LinesPerSecond {
+		if !containsString(test.Scripts, script) {
+			return test, fmt.Errorf("The chip-speed is set for '%s', but there is no such script in the test", script)
+		}
+	}
+	for script := range test.Networks {
+		if !containsString(test.Scripts, script) {
+			return test, fmt.Errorf("Networks are set for '%s', but there is no such script in the test", script)
+		}
+	}
+	for script := range test.Aliases {
+		if !containsString(test.Scripts, script) {
+			return test, fmt.Errorf("Aliases are set for '%s', but there is no such script in the test", script)
+		}
+	}
+	for _, cfg := range test.Devices {
+		_, err = devices.Create(cfg)
+		if err != nil {
+			return test, err
 		}
 	}
 	return test, nil
 }
 
+// ParseDuration parses durations like "12s", "500ms" or "1m30s". A plain number is interpreted as seconds.
+// An empty string results in a duration of 0
+func ParseDuration(duration string) (time.Duration, error) {
+	duration = strings.TrimSpace(duration)
+	if duration == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseFloat(duration, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid duration '%s'", duration)
+	}
+	return d, nil
+}
+
+func containsString(list []string, search string) bool {
+	for _, s := range list {
+		if s == search {
+			return true
+		}
+	}
+	return false
+}
+
 // GetScriptCode returns the code for indexed script.
 func (t Test) GetScriptCode(index int) (string, error) {
 	file := filepath.Join(filepath.Dir(t.Path), t.Scripts[index])
@@ -98,20 +257,126 @@ func (t Test) GetScriptCode(index int) (string, error) {
 
 // Run runs all test-cases
 func (t Test) Run(callback func(Case)) []error {
-	fails := make([]error, 0)
-	for i := range t.Cases {
-		if callback != nil {
-			callback(t.Cases[i])
+	return t.runCases(callback, func(i int) []error {
+		_, stats, casefails := t.runCase(i, nil)
+		t.Report.addCase(t, i, stats, casefails)
+		return casefails
+	})
+}
+
+// RunWithSeed runs all test-cases like Run(), but chips that execute at the same time run in a random order
+// determined by the seed (see vm.Coordinator.SetScheduleSeed())
+func (t Test) RunWithSeed(seed int64, callback func(Case)) []error {
+	return t.runCases(callback, func(i int) []error {
+		_, stats, casefails := t.runCase(i, &seed)
+		seedfails := make([]error, len(casefails))
+		for j, fail := range casefails {
+			seedfails[j] = fmt.Errorf("Seed %d: %s", seed, fail.Error())
 		}
-		runner, err := t.GetRunner(i)
-		if err != nil {
-			fails = append(fails, err)
-			continue
+		t.Report.addCase(t, i, stats, seedfails)
+		return seedfails
+	})
+}
+
+// Fuzz runs every test-case with the default order of execution and then once for every given seed
+// with a randomized order (see RunWithSeed()). Returns the errors of the default runs and an error for every seed
+// that makes a case fail or changes its outputs. A failing seed can be replayed using RunWithSeed().
+func (t Test) Fuzz(seeds []int64, callback func(Case)) []error {
+	return t.runCases(callback, func(i int) []error {
+		c := t.Cases[i]
+		expected, stats, casefails := t.runCase(i, nil)
+		if len(casefails) > 0 {
+			// if the case already fails with the default order, randomizing the order does not tell anything new
+			t.Report.addCase(t, i, stats, casefails)
+			return casefails
+		}
+		for _, seed := range seeds {
+			seed := seed
+			outputs, seedstats, seedfails := t.runCase(i, &seed)
+			stats.add(seedstats)
+			if len(seedfails) > 0 {
+				casefails = append(casefails, fmt.Errorf("Case '%s': Seed %d makes the case fail: %s", c.Name, seed, seedfails[0].Error()))
+				continue
+			}
+			for name, want := range expected {
+				got := outputs[name]
+				if got == nil || !got.Equals(want) || !got.SameType(want) {
+					casefails = append(casefails, fmt.Errorf("Case '%s': Seed %d changes output '%s' from %s to %s", c.Name, seed, name, want.Repr(), reprOrMissing(got)))
+				}
+			}
 		}
-		casefails := runner.Run()
-		fails = append(fails, casefails...)
+		t.Report.addCase(t, i, stats, casefails)
+		return casefails
+	})
+}
+
+// runCase runs the case with the given number. If seed is not nil, the order of execution is randomized using the seed.
+// Returns the final values of the outputs of the case, the stats of the run and the errors that occured
+func (t Test) runCase(casenr int, seed *int64) (map[string]*vm.Variable, caseStats, []error) {
+	start := time.Now()
+	stats := caseStats{}
+	runner, err := t.GetRunner(casenr)
+	if err != nil {
+		return nil, stats, []error{err}
 	}
-	return fails
+	if seed != nil {
+		runner.Coordinator.SetScheduleSeed(*seed)
+	}
+	if t.Trace != nil {
+		run := filepath.Base(t.Path) + "/" + runner.Case.Name
+		if seed != nil {
+			run += fmt.Sprintf(" (seed %d)", *seed)
+		}
+		t.Trace.BeginRun(run)
+		for i, v := range runner.VMs {
+			v.SetTrace(t.Trace, t.Scripts[i])
+		}
+	}
+	if t.Profile != nil && t.Coverage != nil {
+		return nil, stats, []error{fmt.Errorf("Profiling and coverage can not be used at the same time")}
+	}
+	if t.Profile != nil {
+		for i, v := range runner.VMs {
+			v.SetProfile(t.Profile, t.Scripts[i])
+		}
+	}
+	var coverageProfile *vm.Profile
+	if t.Coverage != nil {
+		// count the executions per script-path and add them to the coverage after the run
+		coverageProfile = vm.NewProfile()
+		for i, v := range runner.VMs {
+			source, err := t.GetScriptCode(i)
+			if err != nil {
+				return nil, stats, []error{err}
+			}
+			path := filepath.Join(filepath.Dir(t.Path), t.Scripts[i])
+			t.Coverage.addProgram(path, v.GetProgram(), source)
+			v.SetProfile(coverageProfile, path)
+		}
+	}
+	fails := runner.Run()
+	stats.duration = time.Since(start)
+	stats.simulated = runner.Coordinator.Now()
+	for _, v := range runner.VMs {
+		stats.lines += v.GetExecutedLines()
+	}
+	if coverageProfile != nil {
+		t.Coverage.addProfile(coverageProfile)
+	}
+	outputs := make(map[string]*vm.Variable, len(runner.Case.Outputs))
+	for key := range runner.Case.Outputs {
+		key = prefixVarname(key)
+		outputs[key], _ = runner.Coordinator.GetVariable(key)
+	}
+	return outputs, stats, fails
+}
+
+// reprOrMissing returns the representation of the variable or a note that the variable does not exist
+func reprOrMissing(v *vm.Variable) string {
+	if v == nil {
+		return "<missing>"
+	}
+	return v.Repr()
 }
 
 // GetRunner creates an executable TestRunner for the given testcase
@@ -126,22 +391,76 @@ func (t Test) GetRunner(casenr int) (runner *CaseRunner, err error) {
 		VMs:            make([]*vm.VM, len(t.Scripts)),
 	}
 
-	c.initializeVariables(runner.Coordinator)
-	runner.VMs, runner.VarTranslations, err = t.createVMs(runner.Coordinator)
+	err = t.createVMs(runner)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Snapshot != "" {
+		snap, err := vm.LoadSnapshot(filepath.Join(filepath.Dir(t.Path), t.Snapshot))
+		if err != nil {
+			return nil, err
+		}
+		err = runner.Coordinator.Restore(snap)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, bridge := range t.Bridges {
+		runner.Coordinator.AddBridge(bridge)
+	}
+
+	err = devices.Connect(runner.Coordinator, t.Devices)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.initializeVariables(runner.Coordinator)
+	if err != nil {
+		return nil, err
+	}
+	err = c.scheduleEvents(runner.Coordinator)
+	if err != nil {
+		return nil, err
+	}
+
+	runFor := t.RunFor
+	if c.RunFor != "" {
+		runFor = c.RunFor
+	}
+	timeLimit, err := ParseDuration(runFor)
+	if err != nil {
+		return nil, err
+	}
+	if timeLimit > 0 {
+		// the time-limit counts from the start of the case, which is the time of the snapshot (if any)
+		timeLimit += runner.Coordinator.Now()
+	}
+	runner.Coordinator.SetTimeLimit(timeLimit)
+	if t.DetectIdle {
+		// end the case early if the scripts do not do anything anymore
+		runner.Coordinator.EnableIdleDetection()
+	}
 
 	runner.StopConditions = mergeStopConditions(&t, &c)
 
-	lineExecutedHandler := func(vm *vm.VM) bool {
+	scripts := make(map[*vm.VM]string, len(runner.VMs))
+	for i, v := range runner.VMs {
+		scripts[v] = t.Scripts[i]
+	}
+	runner.checks, err = newCaseChecks(&c, runner.Coordinator, scripts)
+	if err != nil {
+		return nil, err
+	}
 
-		for name, want := range runner.StopConditions {
-			current, exists := vm.GetVariable(name)
-			if exists && current.Equals(want) {
-				// stop condition reached. Terminate all VMs
-				go runner.Coordinator.Terminate()
-				return false
-			}
+	lineExecutedHandler := func(vm *vm.VM) bool {
+		runner.checks.lineExecuted(vm)
+		if runner.stopConditionReached() {
+			// stop condition reached. Terminate all VMs
+			go runner.Coordinator.Terminate()
+			return false
 		}
-
 		return true
 	}
 
@@ -166,13 +485,35 @@ func (c Case) initializeVariables(coord *vm.Coordinator) error {
 	return nil
 }
 
-// createVMs creates and sets up the required vms for this test
-// coord is the coordinator to use with the VMs
-// Run() has been called on the returned VMs, but they are paused until coord.Run() is called
-// Also returns variable-name translation-tables for nolol scripts
-func (t Test) createVMs(coord *vm.Coordinator) ([]*vm.VM, []map[string]string, error) {
-	vms := make([]*vm.VM, len(t.Scripts))
-	translationTables := make([]map[string]string, len(t.Scripts))
+// scheduleEvents schedules the events of the testcase on the given Coordinator.
+// The times of the events are relative to the current simulated time of the coordinator (e.g. the time of a snapshot)
+func (c Case) scheduleEvents(coord *vm.Coordinator) error {
+	start := coord.Now()
+	for _, e := range c.Events {
+		at, err := e.Time()
+		if err != nil {
+			return err
+		}
+		at += start
+		for key, value := range e.Inputs {
+			variable, err := vm.VariableFromType(value)
+			if err != nil {
+				return err
+			}
+			coord.SetVariableAt(at, prefixVarname(key), variable)
+		}
+	}
+	return nil
+}
+
+// createVMs creates and sets up the required vms for this test and stores them in the runner
+// runner.Coordinator is the coordinator to use with the VMs
+// Run() has been called on the created VMs, but they are paused until coord.Run() is called
+// Also stores variable-name translation-tables and definitions for nolol scripts
+func (t Test) createVMs(runner *CaseRunner) error {
+	runner.VMs = make([]*vm.VM, len(t.Scripts))
+	runner.VarTranslations = make([]map[string]string, len(t.Scripts))
+	runner.Definitions = make([]map[string]ast.Expression, len(t.Scripts))
 	for i, script := range t.Scripts {
 		var v *vm.VM
 
@@ -180,32 +521,49 @@ func (t Test) createVMs(coord *vm.Coordinator) ([]*vm.VM, []map[string]string, e
 			conv := nolol.NewConverter()
 			file := filepath.Join(filepath.Dir(t.Path), script)
 			prog, err := conv.ConvertFile(file)
-			translationTables[i] = conv.GetVariableTranslations()
+			runner.VarTranslations[i] = conv.GetVariableTranslations()
+			runner.Definitions[i] = conv.GetDefinitions()
 			if err != nil {
-				return nil, nil, err
+				return err
 			}
 			v = vm.Create(prog)
 		} else {
 			scriptContent, err := t.GetScriptCode(i)
 			if err != nil {
-				return nil, nil, err
+				return err
 			}
 			v, err = vm.CreateFromSource(string(scriptContent))
 			if err != nil {
-				return nil, nil, err
+				return err
 			}
 		}
 
+		// the engine has already been validated by Parse()
+		engine, _ := vm.ParseEngine(t.Engine)
+		err := v.SetEngine(engine)
+		if err != nil {
+			return err
+		}
 		v.SetMaxExecutedLines(t.MaxLines)
-		v.SetCoordinator(coord)
-		vms[i] = v
+		// the mode has already been validated by Parse()
+		mode, _ := vm.ParseErrorMode(t.ErrorMode)
+		v.SetErrorMode(mode)
+		v.SetCoordinator(runner.Coordinator)
+		runner.Coordinator.SetLinesPerSecond(v, t.LinesPerSecond[script])
+		runner.Coordinator.SetNetworks(v, t.Networks[script]...)
+		runner.Coordinator.SetAliases(v, t.Aliases[script])
+		runner.VMs[i] = v
 		v.Resume()
 	}
-	return vms, translationTables, nil
+	return nil
 }
 
 func mergeStopConditions(test *Test, c *Case) map[string]*vm.Variable {
 	conds := make(map[string]*vm.Variable)
+	// If there are no stop-conditions, use a default
+	if len(test.StopWhen) == 0 {
+		conds[":done"], _ = vm.VariableFromType(1)
+	}
 	for k, v := range test.StopWhen {
 		k = prefixVarname(k)
 		conds[k], _ = vm.VariableFromType(v)
@@ -223,34 +581,68 @@ func (cr CaseRunner) Run() []error {
 	fails := make([]error, 0)
 	flock := &sync.Mutex{}
 
-	errHandler := func(vm *vm.VM, err error) bool {
+	errHandler := func(v *vm.VM, err error) {
+		// the line has been aborted. It still counts as executed
+		cr.checks.lineExecuted(v)
 		if !cr.Test.IgnoreErrs {
 			flock.Lock()
 			defer flock.Unlock()
 			fails = append(fails, err)
 			go cr.Coordinator.Terminate()
-			return false
+		} else if cr.stopConditionReached() {
+			// the part of the line before the error has reached the stop-condition.
+			// Halt the chip, so it does not run another line before all chips are terminated
+			v.SetErrorMode(vm.ErrorModeHalt)
+			go cr.Coordinator.Terminate()
 		}
-		return true
 	}
 
-	for _, vm := range cr.VMs {
-		vm.SetErrorHandler(errHandler)
+	for _, v := range cr.VMs {
+		v.SetErrorHandler(errHandler)
+		if !cr.Test.IgnoreErrs {
+			// the failing chip stops immediately, the others are terminated by the error-handler
+			v.SetErrorMode(vm.ErrorModeHalt)
+		}
 	}
 
 	cr.Coordinator.Run()
 	cr.Coordinator.WaitForTermination()
 
-	caseFails := cr.Case.checkResults(cr.Coordinator)
-	fails = append(fails, caseFails...)
+	fails = append(fails, cr.checks.results()...)
+	fails = append(fails, cr.Case.checkResults(cr.Coordinator)...)
+	// idle chips will never reach a stop-condition or change an output. Report why the case failed first
+	explicitStop := len(cr.Test.StopWhen) > 0 || len(cr.Case.StopWhen) > 0
+	if idle := cr.Coordinator.Idle(); idle != nil && (len(fails) > 0 || (explicitStop && !cr.stopConditionReached())) {
+		fails = append([]error{*idle}, fails...)
+	}
 	return fails
 }
 
+// stopConditionReached returns true if at least one of the stop-conditions is fulfilled
+func (cr CaseRunner) stopConditionReached() bool {
+	for name, want := range cr.StopConditions {
+		current, exists := cr.Coordinator.GetVariable(name)
+		if exists && current.Equals(want) {
+			return true
+		}
+	}
+	return false
+}
+
 // checkResults compares the global variables of coord with the expected results for c
 // and returns found errors
 func (c Case) checkResults(coord *vm.Coordinator) []error {
+	return c.checkVariables(coord, c.Outputs, "")
+}
+
+// checkVariables compares the global variables of coord with the expected values and returns found errors.
+// If context is not empty, it is added to the error-messages to describe when the values have been checked
+func (c Case) checkVariables(coord *vm.Coordinator, expectedValues map[string]interface{}, context string) []error {
 	fails := make([]error, 0)
-	for key, value := range c.Outputs {
+	if context != "" {
+		context = " (" + context + ")"
+	}
+	for key, value := range expectedValues {
 		key = prefixVarname(key)
 		var fail error
 		expected, err := vm.VariableFromType(value)
@@ -262,13 +654,13 @@ func (c Case) checkResults(coord *vm.Coordinator) []error {
 		actual, exists := coord.GetVariable(key)
 
 		if !exists {
-			fail = fmt.Errorf("Expected output variable %s does not exist", key)
+			fail = fmt.Errorf("Expected output variable %s does not exist%s", key, context)
 		} else {
 			if !actual.SameType(expected) {
-				fail = fmt.Errorf("Case '%s': Output '%s' has type '%s' but should be '%s' ", c.Name, key, actual.TypeName(), expected.TypeName())
+				fail = fmt.Errorf("Case '%s': Output '%s' has type '%s' but should be '%s'%s ", c.Name, key, actual.TypeName(), expected.TypeName(), context)
 
 			} else if !actual.Equals(expected) {
-				fail = fmt.Errorf("Case '%s': Output '%s' has value %s but should be %s ", c.Name, key, actual.Repr(), expected.Repr())
+				fail = fmt.Errorf("Case '%s': Output '%s' has value %s but should be %s%s ", c.Name, key, actual.Repr(), expected.Repr(), context)
 			}
 		}
 		if fail != nil {
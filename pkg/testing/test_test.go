@@ -1,9 +1,19 @@
 package testing_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	thistesting "github.com/dbaumgarten/yodk/pkg/testing"
+	"github.com/dbaumgarten/yodk/pkg/vm"
 )
 
 func TestTestcase(t *testing.T) {
@@ -105,3 +115,686 @@ if :number%5==0 then :out+="buzz " end
 		t.Fatalf("Testcase should have 1 error, but had: %d", len(fails))
 	}
 }
+
+func TestRunFor(t *testing.T) {
+	testcase := `scripts:
+  - slow.yolol
+  - fast.yolol
+runfor: 12s
+linespersecond:
+  fast.yolol: 10
+cases:
+  - name: TestTwelveSeconds
+    outputs:
+      slow: 60
+      fast: 120
+  - name: TestOneSecond
+    runfor: 1
+    outputs:
+      slow: 5
+      fast: 10
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{":slow++", ":fast++"}
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatalf("Testcase had errors but should not: %v", fails)
+	}
+}
+
+func TestSnapshotTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yodk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = vm.SaveSnapshot(filepath.Join(dir, "snapshot.json"), &vm.CoordinatorSnapshot{
+		Globals:       map[string]string{":count": "10"},
+		VMs:           []*vm.VMSnapshot{{CurrentAstLine: 1}},
+		Now:           time.Minute,
+		NextLineTimes: []time.Duration{time.Minute},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// runfor and events count from the time of the snapshot
+	testcase := `scripts:
+  - counter.yolol
+snapshot: snapshot.json
+runfor: 2s
+cases:
+  - name: ContinueCounting
+    events:
+      - tick: 6
+        inputs:
+          count: 100
+    outputs:
+      count: 105
+`
+	test, err := thistesting.Parse([]byte(testcase), filepath.Join(dir, "counter_test.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{":count++"}
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatalf("Testcase had errors but should not: %v", fails)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	testcase := `scripts:
+  - door.yolol
+runfor: 3s
+devices:
+  - type: hinge
+    fields:
+      hingeangle: doorangle
+    options:
+      speed: 45
+cases:
+  - name: TestDoorOpens
+    inputs:
+      doorangle: 0
+    outputs:
+      hingetarget: 90
+      opened: 1
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{`:hingetarget = 90 if :doorangle == 90 then :opened = 1 end`}
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatalf("Testcase had errors but should not: %v", fails)
+	}
+
+	_, err = thistesting.Parse([]byte(strings.Replace(testcase, "hinge\n", "teleporter\n", 1)), "")
+	if err == nil {
+		t.Fatal("Parsing a test with an unknown device should fail")
+	}
+}
+
+func TestNetworks(t *testing.T) {
+	testcase := `scripts:
+  - engine.yolol
+  - cockpit.yolol
+runfor: 1s
+networks:
+  engine.yolol: [engine]
+  cockpit.yolol: [cockpit]
+bridges:
+  - from: engine
+    to: cockpit
+    fields: [fuel]
+devices:
+  - type: fueltank
+    network: engine
+cases:
+  - name: TestIsolation
+    inputs:
+      cockpit:display: ""
+    outputs:
+      engine:thrust: 0
+      cockpit:display: "fuel: 100"
+      cockpit:fuel: 100
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{
+		`:thrust = :throttle`,
+		`:throttle = 1 :display = "fuel: " + :fuel`,
+	}
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatalf("Testcase had errors but should not: %v", fails)
+	}
+}
+
+func TestMemoryAndAliases(t *testing.T) {
+	testcase := `scripts:
+  - gauge.yolol
+runfor: 1s
+devices:
+  - type: memory
+    values:
+      FuelLevel: 42
+      unit: "l"
+aliases:
+  gauge.yolol:
+    a: fuellevel
+cases:
+  - name: TestAliasedMemory
+    outputs:
+      display: "42l"
+      fuellevel: 42
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{`:display = :a + :unit`}
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatalf("Testcase had errors but should not: %v", fails)
+	}
+
+	_, err = thistesting.Parse([]byte(`scripts:
+  - gauge.yolol
+devices:
+  - type: memory
+`), "")
+	if err == nil {
+		t.Fatal("Parsing a test with a memory-chip without fields should fail")
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	testcase := `scripts:
+  - writer.yolol
+  - reader.yolol
+runfor: 0.1s
+cases:
+  - name: TestOrderDependent
+    outputs:
+      y: 1
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{`:x = 1`, `:y = :x`}
+
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatalf("The case should pass with the default order: %v", fails)
+	}
+
+	seeds := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	fails = test.Fuzz(seeds, nil)
+	if len(fails) == 0 {
+		t.Fatal("Fuzzing should have detected the order-dependency")
+	}
+
+	failing := int64(-1)
+	for _, seed := range seeds {
+		if len(test.RunWithSeed(seed, nil)) > 0 {
+			failing = seed
+			break
+		}
+	}
+	if failing < 0 {
+		t.Fatal("Replaying the seeds did not reproduce the failure")
+	}
+	if len(test.RunWithSeed(failing, nil)) == 0 {
+		t.Fatal("Replaying a failing seed must fail again")
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	testcase := `scripts:
+  - state.yolol
+runfor: 1s
+cases:
+  - name: StateOne
+    inputs:
+      state: 1
+    outputs:
+      out: "one"
+  - name: StateTwo
+    inputs:
+      state: 2
+    outputs:
+      out: "two"
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{`if :state == 1 then :out = "one" end
+if :state == 2 then :out = "two" end
+if :state == 3 then :out = "three" end
+goto 1`}
+	test.Coverage = thistesting.NewCoverage()
+
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatal(fails)
+	}
+
+	summary := test.Coverage.Summary()
+	// the assignment in line 3 is never executed and the condition in line 3 is never true
+	if summary.Statements != 7 || summary.CoveredStatements != 6 || summary.Branches != 6 || summary.CoveredBranches != 5 {
+		t.Fatalf("Wrong coverage-summary: %+v", summary)
+	}
+
+	lcov := &strings.Builder{}
+	err = test.Coverage.WriteLCOV(lcov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"SF:state.yolol", "DA:3,2", "BRDA:3,0,0,0", "BRF:6", "BRH:5", "LF:4", "LH:4", "end_of_record"} {
+		if !strings.Contains(lcov.String(), expected+"\n") {
+			t.Fatalf("The lcov-output does not contain '%s':\n%s", expected, lcov.String())
+		}
+	}
+
+	out := &strings.Builder{}
+	err = test.Coverage.WriteSummary(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "state.yolol:3:1: condition never true") {
+		t.Fatalf("The summary does not report the untaken branch:\n%s", out.String())
+	}
+
+	test.Profile = vm.NewProfile()
+	if len(test.Run(nil)) == 0 {
+		t.Fatal("Using profile and coverage at the same time must fail")
+	}
+}
+
+func TestIdleChips(t *testing.T) {
+	testcase := `scripts:
+  - waiter.yolol
+  - sender.yolol
+maxlines: 100000
+detectidle: true
+stopwhen:
+  done: 1
+cases:
+  - name: Deadlock
+    inputs:
+      go: 0
+    outputs:
+      done: 1
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{"if not :go then goto 1 end\n:done = 1", "if :done then :go = 1 end goto 1"}
+
+	fails := test.Run(nil)
+	if len(fails) == 0 {
+		t.Fatal("The deadlocked case must fail")
+	}
+	if _, isIdle := fails[0].(vm.IdleError); !isIdle {
+		t.Fatalf("The first error should report the idle chips, but is: %v", fails[0])
+	}
+	if !strings.Contains(fails[0].Error(), "idle since tick 1") {
+		t.Fatalf("Wrong idle-message: %s", fails[0].Error())
+	}
+
+	// without an explicit stop-condition, the idle chips are reported together with the failed outputs
+	test, err = thistesting.Parse([]byte(strings.Replace(testcase, "stopwhen:\n  done: 1\n", "", 1)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{"if not :go then goto 1 end\n:done = 1", "if :done then :go = 1 end goto 1"}
+	fails = test.Run(nil)
+	if len(fails) < 2 {
+		t.Fatalf("The idle chips and the wrong output should have been reported, but got: %v", fails)
+	}
+	if _, isIdle := fails[0].(vm.IdleError); !isIdle {
+		t.Fatalf("The first error should report the idle chips, but is: %v", fails[0])
+	}
+}
+
+func TestIdleMovingDevice(t *testing.T) {
+	testcase := `scripts:
+  - door.yolol
+runfor: 60s
+detectidle: true
+devices:
+  - type: hinge
+    options:
+      speed: 0.001
+cases:
+  - name: SlowHinge
+    outputs:
+      done: 1
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the angle of the hinge changes only every second, but the hinge is moving all the time
+	test.ScriptContents = []string{":hingetarget = 0.01\nif :hingeangle < 0.01 then goto 2 end\n:done = 1"}
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatalf("A chip waiting for a moving hinge is not idle: %v", fails)
+	}
+}
+
+func TestErrorMode(t *testing.T) {
+	testcase := `scripts:
+  - errors.yolol
+ignoreerrs: true
+errormode: %s
+cases:
+  - name: Errors
+    outputs:
+      a: 1
+      b: 1
+`
+	script := ":a = 1 x = 1/0 :a = 2\n:b = 1"
+	// halting the chip prevents :b from being set
+	for mode, shouldFail := range map[string]bool{"abortline": false, "halt": true} {
+		test, err := thistesting.Parse([]byte(fmt.Sprintf(testcase, mode)), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ScriptContents = []string{script}
+		fails := test.Run(nil)
+		if (len(fails) != 0) != shouldFail {
+			t.Fatalf("Mode %s: unexpected result: %v", mode, fails)
+		}
+	}
+
+	_, err := thistesting.Parse([]byte(fmt.Sprintf(testcase, "pause")), "")
+	if err == nil {
+		t.Fatal("The error-mode pause must be rejected")
+	}
+	_, err = thistesting.Parse([]byte(strings.Replace(fmt.Sprintf(testcase, "halt"), "ignoreerrs: true\n", "", 1)), "")
+	if err == nil {
+		t.Fatal("An error-mode without ignoreerrs must be rejected")
+	}
+
+	// the stop-condition is reached by the line that is aborted by the error
+	test, err := thistesting.Parse([]byte(fmt.Sprintf(testcase, "abortline")), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Cases[0].Outputs = map[string]interface{}{"done": 1}
+	test.ScriptContents = []string{":done = 1 x = 1/0\n:done = 2 goto 2"}
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatalf("The case should have stopped after the first line: %v", fails)
+	}
+}
+
+func TestEngine(t *testing.T) {
+	testcase := `scripts:
+  - engine.yolol
+engine: %s
+cases:
+  - name: Loop
+    outputs:
+      count: 10
+      text: "xxxxxxxxxx"
+`
+	script := ":text = \"\"\n:count++ :text += \"x\" :done = :count == 10 goto 2"
+	for _, engine := range []string{"", "interpreter", "compiled"} {
+		test, err := thistesting.Parse([]byte(fmt.Sprintf(testcase, engine)), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ScriptContents = []string{script}
+		if fails := test.Run(nil); len(fails) != 0 {
+			t.Fatalf("Engine '%s': unexpected failures: %v", engine, fails)
+		}
+	}
+
+	_, err := thistesting.Parse([]byte(fmt.Sprintf(testcase, "jit")), "")
+	if err == nil {
+		t.Fatal("An unknown engine must be rejected")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	testcase := `scripts:
+  - counter.yolol
+stopwhen:
+  done: 1
+cases:
+  - name: PressAndRelease
+    events:
+      - tick: 30
+        inputs:
+          button: 1
+      - at: 7s
+        inputs:
+          button: 0
+    outputs:
+      pressed: 3
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every iteration takes two lines (400ms). The button is pressed from 5.8s to 7s: at 6.0s, 6.4s and 6.8s
+	test.ScriptContents = []string{"if :button then :pressed++ end\nif :pressed and not :button then :done = 1 end goto 1"}
+	fails := test.Run(nil)
+	if len(fails) != 0 {
+		t.Fatal(fails)
+	}
+
+	invalid := strings.Replace(testcase, "tick: 30", "tick: 30\n        at: 6s", 1)
+	_, err = thistesting.Parse([]byte(invalid), "")
+	if err == nil {
+		t.Fatal("Events with a tick and a time must be rejected")
+	}
+}
+
+func TestIntermediateAssertions(t *testing.T) {
+	testcase := `scripts:
+  - lamp.yolol
+runfor: 10s
+cases:
+  - name: Flicker
+    events:
+      - tick: 10
+        inputs:
+          button: 1
+    checkpoints:
+      - tick: 9
+        outputs:
+          lamp: 0
+      - lines: 20
+        outputs:
+          lamp: 1
+      - at: 20s
+        outputs:
+          lamp: 1
+    eventually:
+      - within: 1
+        outputs:
+          lamp: 1
+    invariants:
+      lamp: 0
+`
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lamp flickers on for a single line and is switched on once the button is pressed
+	test.ScriptContents = []string{":lamp = 0\n:lamp = 1\n:lamp = :button goto 3"}
+	fails := test.Run(nil)
+
+	expected := []string{
+		"':lamp' has value 0 but should be 1 (expected within 1 lines)",
+		"':lamp' has value 1 but should be 0 (invariant violated at 200ms by lamp.yolol:2)",
+		"The checkpoint at 20s has not been reached",
+	}
+	if len(fails) != len(expected) {
+		t.Fatalf("Expected %d fails, but got: %v", len(expected), fails)
+	}
+	for i, exp := range expected {
+		if !strings.Contains(fails[i].Error(), exp) {
+			t.Fatalf("Fail %d should contain '%s', but is: %s", i, exp, fails[i].Error())
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	testcase := `scripts:
+  - counter.yolol
+maxlines: 10
+cases:
+  - name: Pass
+    outputs:
+      count: 11
+  - name: Fail
+    outputs:
+      count: 12
+`
+	test, err := thistesting.Parse([]byte(testcase), "/tests/counter_test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{":count++ goto 1"}
+	report := thistesting.NewReport("/tests")
+	report.AddFileError("/tests/broken_test.yaml", fmt.Errorf("syntax error"))
+	test.Report = report
+	test.Run(nil)
+
+	files := report.Files()
+	if len(files) != 2 || files[0].Path != "broken_test.yaml" || files[1].Path != "counter_test.yaml" {
+		t.Fatalf("Wrong files in report: %v", files)
+	}
+	cases := files[1].Cases
+	if len(cases) != 2 || !cases[0].Passed() || cases[1].Passed() || cases[0].ExecutedLines != 11 || cases[0].SimulatedTime < 2*time.Second {
+		t.Fatalf("Wrong case-results: %+v", cases)
+	}
+
+	buf := &bytes.Buffer{}
+	err = report.WriteJUnit(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`<testsuites tests="3" failures="1" errors="1"`, `<testcase name="Fail" classname="counter_test.yaml"`, `<failure message="Case &#39;Fail&#39;: Output &#39;:count&#39; has value 11 but should be 12 " type="failure">`, `<error message="syntax error" type="error">`} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("The junit-report should contain '%s', but is:\n%s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	err = report.WriteTAP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"1..3\n", "not ok 1 - broken_test.yaml\n", "ok 2 - counter_test.yaml: Pass\n", "not ok 3 - counter_test.yaml: Fail\n", "  executed_lines: 11\n"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("The tap-report should contain '%s', but is:\n%s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	err = report.Write(buf, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded["passed"] != false || decoded["tests"] != float64(2) || decoded["failed"] != float64(1) {
+		t.Fatalf("Wrong json-report: %s", buf.String())
+	}
+
+	if report.Write(buf, "html") == nil {
+		t.Fatal("Unknown formats must be rejected")
+	}
+
+	buf.Reset()
+	err = report.WriteSummary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedSummary := "2 test-files, 2 cases: 1 passed, 1 failed\nError: broken_test.yaml could not be run\nFailed: counter_test.yaml: Fail\n"
+	if buf.String() != expectedSummary {
+		t.Fatalf("Wrong summary:\n%s", buf.String())
+	}
+}
+
+func TestParallel(t *testing.T) {
+	testcase := `scripts:
+  - counter.yolol
+maxlines: 200
+cases:
+`
+	for i := 0; i < 20; i++ {
+		testcase += fmt.Sprintf("  - name: Case%d\n    inputs:\n      start: %d\n    outputs:\n      count: 0\n", i, i)
+	}
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{":count = :start + 1 goto 1"}
+
+	sequential := test.Run(nil)
+	test.Pool = thistesting.NewPool(4)
+	test.Report = thistesting.NewReport("")
+	names := make([]string, 0)
+	parallel := test.Run(func(c thistesting.Case) {
+		names = append(names, c.Name)
+	})
+
+	if len(parallel) != 20 || len(sequential) != len(parallel) {
+		t.Fatalf("Every case should fail once, but got %d and %d fails", len(sequential), len(parallel))
+	}
+	for i := range parallel {
+		if parallel[i].Error() != sequential[i].Error() || names[i] != fmt.Sprintf("Case%d", i) {
+			t.Fatalf("The results of parallel runs must be in the order of the cases. Got %v", parallel)
+		}
+	}
+	cases := test.Report.Files()[0].Cases
+	for i, c := range cases {
+		if c.Name != names[i] {
+			t.Fatalf("The report must list the cases in the order of the test-file")
+		}
+	}
+}
+
+func TestFindTestFiles(t *testing.T) {
+	examples := filepath.Join("..", "..", "examples")
+	yololFile := filepath.Join(examples, "yolol", "fizzbuzz_test.yaml")
+
+	files, err := thistesting.FindTestFiles([]string{yololFile, filepath.Join(examples, "yolol")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 || files[0] != yololFile {
+		t.Fatalf("Explicit files must come first and must not be duplicated: %v", files)
+	}
+	for i, file := range files {
+		if !strings.HasSuffix(file, "_test.yaml") || filepath.Dir(file) != filepath.Join(examples, "yolol") || (i > 0 && file == yololFile) {
+			t.Fatalf("Wrong file found: %s", file)
+		}
+	}
+
+	if files, _ := thistesting.FindTestFiles([]string{examples}); len(files) != 0 {
+		t.Fatalf("Sub-directories must only be searched using '...', but found: %v", files)
+	}
+	recursive, err := thistesting.FindTestFiles([]string{examples + "/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nolol, _ := thistesting.FindTestFiles([]string{filepath.Join(examples, "nolol")})
+	if len(recursive) != len(files)+len(nolol) {
+		t.Fatalf("The recursive search should have found all test-files, but found: %v", recursive)
+	}
+
+	if _, err := thistesting.FindTestFiles([]string{"does-not-exist"}); err == nil {
+		t.Fatal("Missing files must be reported")
+	}
+}
+
+func TestSelectCases(t *testing.T) {
+	test := thistesting.Test{
+		Cases: []thistesting.Case{{Name: "OpenDoor"}, {Name: "CloseDoor"}, {Name: "Alarm"}},
+	}
+	test.SelectCases(regexp.MustCompile("Door$"))
+	if len(test.Cases) != 2 || test.Cases[0].Name != "OpenDoor" || test.Cases[1].Name != "CloseDoor" {
+		t.Fatalf("Wrong cases selected: %v", test.Cases)
+	}
+}
@@ -0,0 +1,43 @@
+package vm
+
+import (
+	"strings"
+)
+
+// SetAliases sets aliases for the global variables used by the given vm. Keys are the names used in the script,
+// values the names of the global variables (or device-fields) the script actually accesses.
+// This allows running scripts against devices whose fields are named differently, without editing the scripts.
+// Passing an empty map removes all aliases of the vm
+func (c *Coordinator) SetAliases(v *VM, aliases map[string]string) {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	if len(aliases) == 0 {
+		delete(c.aliases, v)
+		return
+	}
+	normalized := make(map[string]string, len(aliases))
+	for alias, field := range aliases {
+		normalized[QualifiedName(DefaultNetwork, alias)] = QualifiedName(DefaultNetwork, field)
+	}
+	c.aliases[v] = normalized
+}
+
+// Aliases returns the aliases of the given vm
+func (c *Coordinator) Aliases(v *VM) map[string]string {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	aliases := make(map[string]string, len(c.aliases[v]))
+	for alias, field := range c.aliases[v] {
+		aliases[alias] = field
+	}
+	return aliases
+}
+
+// resolveAlias returns the name of the global variable the given vm accesses when using name
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (c *Coordinator) resolveAlias(v *VM, name string) string {
+	if field, exists := c.aliases[v][strings.ToLower(name)]; exists {
+		return field
+	}
+	return name
+}
@@ -0,0 +1,40 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestAliases(t *testing.T) {
+	coord := vm.NewCoordinator()
+	v, _ := vm.CreateSyncFromSource(`:a = :b + 1 :c = :a`)
+	v.SetCoordinator(coord)
+	v.Resume()
+	coord.SetAliases(v, map[string]string{
+		"a":  "FuelLevel",
+		":B": ":tank",
+	})
+	coord.SetVariable(":tank", &vm.Variable{Value: "full"})
+	coord.AddWatchpoint(":fuellevel")
+	watched := ""
+	v.SetWatchpointHandler(func(v *vm.VM, name string, old *vm.Variable, new *vm.Variable) bool {
+		watched = name
+		return true
+	})
+
+	coord.Tick()
+
+	for name, want := range map[string]string{":fuellevel": "full1", ":c": "full1"} {
+		got, exists := coord.GetVariable(name)
+		if !exists || got.String() != want {
+			t.Fatalf("Variable %s should be %s but is %v", name, want, got)
+		}
+	}
+	if _, exists := coord.GetVariable(":a"); exists {
+		t.Fatal("The aliased variable must not be created")
+	}
+	if watched != ":a" {
+		t.Fatalf("Writing the alias should trigger the watchpoint of the field. Got: '%s'", watched)
+	}
+}
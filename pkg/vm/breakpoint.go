@@ -0,0 +1,179 @@
+package vm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// LogFunc is a function that is called when a logpoint is hit. It receives the interpolated log-message
+type LogFunc func(vm *VM, message string)
+
+// Breakpoint is a breakpoint at a source-line. It can optionally carry a condition, a hit-condition
+// and a log-message. A breakpoint with a log-message (logpoint) never pauses the vm, but emits the message instead.
+type Breakpoint struct {
+	// the source-line of the breakpoint
+	Line int
+	// if > 0, the breakpoint only triggers before the statement starting at this coloumn
+	// instead of when reaching the line
+	Column int
+	// a yolol-expression. If set, the breakpoint only triggers if the expression evaluates to a value != 0
+	// in the variable-scope of the vm
+	Condition string
+	// if set, the breakpoint only triggers if the number of hits matches this condition.
+	// Supported formats are: "N" or "==N" (exactly the n-th hit), ">N", ">=N", "<N", "<=N" and "%N" (every n-th hit)
+	HitCondition string
+	// if set, this message is logged instead of pausing the vm. Text in curly braces (e.g. {:x}) is replaced
+	// by the current value of the variable with this name
+	LogMessage string
+	// parsed version of Condition
+	condition ast.Expression
+	// the operator and value of HitCondition
+	hitOperator string
+	hitCount    int
+	// the number of times the line has been reached while the condition was true
+	hits int
+}
+
+var hitConditionRegex = regexp.MustCompile(`^\s*(==|>=|<=|>|<|%)?\s*([0-9]+)\s*$`)
+
+var logInterpolationRegex = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// NewBreakpoint creates a new breakpoint for the given line. Condition, hitCondition and logMessage are optional
+// and can be left empty. Returns an error if the condition or the hit-condition are invalid.
+func NewBreakpoint(line int, condition string, hitCondition string, logMessage string) (*Breakpoint, error) {
+	bp := &Breakpoint{
+		Line:         line,
+		Condition:    condition,
+		HitCondition: hitCondition,
+		LogMessage:   logMessage,
+	}
+
+	if strings.TrimSpace(condition) != "" {
+		expr, err := parser.NewParser().ParseExpressionString(condition)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid breakpoint-condition: %s", err.Error())
+		}
+		// evaluating the condition must not change the state of the vm
+		err = checkSideEffects(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid breakpoint-condition: %s", err.Error())
+		}
+		bp.condition = expr
+	}
+
+	if strings.TrimSpace(hitCondition) != "" {
+		match := hitConditionRegex.FindStringSubmatch(hitCondition)
+		if match == nil {
+			return nil, fmt.Errorf("Invalid hit-condition '%s'", hitCondition)
+		}
+		bp.hitOperator = match[1]
+		if bp.hitOperator == "" {
+			bp.hitOperator = "=="
+		}
+		bp.hitCount, _ = strconv.Atoi(match[2])
+		if bp.hitOperator == "%" && bp.hitCount == 0 {
+			return nil, fmt.Errorf("Invalid hit-condition '%s'", hitCondition)
+		}
+	}
+
+	return bp, nil
+}
+
+// IsLogpoint returns true if the breakpoint logs a message instead of pausing the vm
+func (b *Breakpoint) IsLogpoint() bool {
+	return b.LogMessage != ""
+}
+
+// Hits returns how often the breakpoint has been reached while its condition was true
+func (b *Breakpoint) Hits() int {
+	return b.hits
+}
+
+// hitConditionMet checks if the current number of hits satisfies the hit-condition
+func (b *Breakpoint) hitConditionMet() bool {
+	switch b.hitOperator {
+	case "":
+		return true
+	case "==":
+		return b.hits == b.hitCount
+	case ">":
+		return b.hits > b.hitCount
+	case ">=":
+		return b.hits >= b.hitCount
+	case "<":
+		return b.hits < b.hitCount
+	case "<=":
+		return b.hits <= b.hitCount
+	case "%":
+		return b.hits%b.hitCount == 0
+	}
+	return true
+}
+
+// AddConditionalBreakpoint adds the given breakpoint. An existing breakpoint at the same location is replaced.
+func (v *VM) AddConditionalBreakpoint(bp *Breakpoint) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if bp.Column > 0 {
+		if v.columnBreakpoints[bp.Line] == nil {
+			v.columnBreakpoints[bp.Line] = make(map[int]*Breakpoint)
+		}
+		v.columnBreakpoints[bp.Line][bp.Column] = bp
+		return
+	}
+	v.breakpoints[bp.Line] = bp
+}
+
+// GetBreakpoint returns the breakpoint at the given line (and coloumn), or nil if there is none.
+// Use column 0 to get the breakpoint for the whole line
+func (v *VM) GetBreakpoint(line int, column int) *Breakpoint {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if column > 0 {
+		return v.columnBreakpoints[line][column]
+	}
+	return v.breakpoints[line]
+}
+
+// SetLogHandler sets the function to be called when a logpoint is hit
+func (v *VM) SetLogHandler(f LogFunc) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.logHandler = f
+}
+
+// breakpointTriggers updates the hit-count of the breakpoint and checks if it should trigger.
+// If the condition can not be evaluated, the breakpoint triggers, so the user notices the faulty condition.
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) breakpointTriggers(bp *Breakpoint) bool {
+	if bp.condition != nil {
+		result, err := v.runExpr(bp.condition)
+		if err == nil && result.IsNumber() && result.Number() == number.Zero {
+			return false
+		}
+	}
+	bp.hits++
+	return bp.hitConditionMet()
+}
+
+// interpolateLogMessage replaces all {variable} in the message with the value of the variable
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) interpolateLogMessage(message string) string {
+	return logInterpolationRegex.ReplaceAllStringFunc(message, func(match string) string {
+		name := strings.TrimSpace(match[1 : len(match)-1])
+		value, exists := v.getVariable(name)
+		if !exists {
+			return "0"
+		}
+		if value.IsNumber() {
+			return value.Itoa()
+		}
+		return value.String()
+	})
+}
@@ -0,0 +1,64 @@
+package vm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestConditionalBreakpoints(t *testing.T) {
+	prog := `a = 0
+a++
+b = a * 2
+if a < 10 then goto 2 end
+:done = 1
+`
+	v, _ := vm.CreateFromSource(prog)
+	v.SetLineExecutedHandler(vm.TerminateOnDoneVar)
+
+	hits := make([]string, 0)
+	v.SetBreakpointHandler(func(x *vm.VM) bool {
+		a, _ := x.GetVariable("a")
+		hits = append(hits, fmt.Sprintf("%d:%s", x.CurrentSourceLine(), a.Itoa()))
+		return true
+	})
+	logs := make([]string, 0)
+	v.SetLogHandler(func(x *vm.VM, message string) {
+		logs = append(logs, message)
+	})
+
+	bp, err := vm.NewBreakpoint(3, "a > 3 and a < 7", "%2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.AddConditionalBreakpoint(bp)
+
+	lp, err := vm.NewBreakpoint(4, "", ">8", "a={a} b={b}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.AddConditionalBreakpoint(lp)
+
+	v.Resume()
+	v.WaitForTermination()
+
+	expectedHits := []string{"3:5"}
+	if fmt.Sprint(hits) != fmt.Sprint(expectedHits) {
+		t.Fatalf("Wrong breakpoint-hits. Wanted %v but got %v", expectedHits, hits)
+	}
+	expectedLogs := []string{"a=9 b=18", "a=10 b=20"}
+	if fmt.Sprint(logs) != fmt.Sprint(expectedLogs) {
+		t.Fatalf("Wrong log-messages. Wanted %v but got %v", expectedLogs, logs)
+	}
+	if bp.Hits() != 3 || lp.Hits() != 10 {
+		t.Fatalf("Wrong hit-counts: %d, %d", bp.Hits(), lp.Hits())
+	}
+
+	if _, err := vm.NewBreakpoint(1, "a++ > 3", "", ""); err == nil {
+		t.Fatal("Conditions with side-effects should be rejected")
+	}
+	if _, err := vm.NewBreakpoint(1, "", "every 3", ""); err == nil {
+		t.Fatal("Invalid hit-conditions should be rejected")
+	}
+}
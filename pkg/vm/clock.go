@@ -0,0 +1,136 @@
+package vm
+
+import (
+	"math/rand"
+	"time"
+)
+
+// DefaultLinesPerSecond is the speed of a yolol-chip in Starbase
+const DefaultLinesPerSecond = 5
+
+// The coordinator keeps track of the simulated (in-game) time. Every coordinated vm runs its lines at a fixed speed.
+// The vm whose next line is due first runs next. Vms whose lines are due at the same time run in the order
+// they have been registered. If all vms run at the same speed, this results in a plain round-robin execution.
+// The game does not guarantee any order for chips running at the same time. To find scripts that depend on the
+// order of execution, the order can be randomized using SetScheduleSeed().
+
+// SetLinesPerSecond sets the speed of the given coordinated vm in lines per second of simulated time.
+// A value <= 0 resets the speed to DefaultLinesPerSecond
+func (c *Coordinator) SetLinesPerSecond(v *VM, linesPerSecond float64) {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	if linesPerSecond <= 0 {
+		delete(c.lineIntervals, v)
+		return
+	}
+	c.lineIntervals[v] = time.Duration(float64(time.Second) / linesPerSecond)
+}
+
+// LinesPerSecond returns the speed of the given vm in lines per second of simulated time
+func (c *Coordinator) LinesPerSecond(v *VM) float64 {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	return float64(time.Second) / float64(c.lineInterval(v))
+}
+
+// Now returns the current simulated time, measured from the start of the execution.
+// While a line is executed, this is the time at which the execution of the line started
+func (c *Coordinator) Now() time.Duration {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	return c.now
+}
+
+// tickAt returns the tick the given simulated time belongs to. The first lines run at tick 1 and a tick lasts as long as
+// one line of a chip running at the default speed (see DefaultLinesPerSecond)
+func tickAt(t time.Duration) int {
+	return int(t/(time.Second/DefaultLinesPerSecond)) + 1
+}
+
+// SetTimeLimit makes the coordinator terminate all vms once the given amount of simulated time has passed.
+// Only lines that start before the limit are executed. A limit <= 0 disables this
+func (c *Coordinator) SetTimeLimit(limit time.Duration) {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	c.timeLimit = limit
+}
+
+// SetScheduleSeed makes the coordinator pick a random order for vms whose lines are due at the same time,
+// instead of using the registration-order. The random order is fully determined by the seed, so a run can be
+// replayed by using the same seed again.
+// MUST be called before Run() or Tick()
+func (c *Coordinator) SetScheduleSeed(seed int64) {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	c.scheduleRand = rand.New(rand.NewSource(seed))
+}
+
+// lineInterval returns the simulated time between two lines of the given vm
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (c *Coordinator) lineInterval(v *VM) time.Duration {
+	if interval, exists := c.lineIntervals[v]; exists {
+		return interval
+	}
+	return time.Second / DefaultLinesPerSecond
+}
+
+// nextScheduled returns the index of the vm that runs the next line and advances the simulated time to the start of this line.
+// If skipTerminated is true, vms that have already terminated are ignored.
+// Returns -1 if there is no vm left to run
+func (c *Coordinator) nextScheduled(skipTerminated bool) (int, time.Duration) {
+	var terminated map[int]bool
+	if skipTerminated {
+		terminated = make(map[int]bool)
+		for i, v := range c.registeredVMs() {
+			terminated[i] = v.State() == StateTerminated
+		}
+	}
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	next := -1
+	// the number of vms due at the same time as next
+	candidates := 0
+	for i := range c.nextLineTimes {
+		if terminated[i] {
+			continue
+		}
+		if next < 0 || c.nextLineTimes[i] < c.nextLineTimes[next] {
+			next = i
+			candidates = 1
+		} else if c.scheduleRand != nil && c.nextLineTimes[i] == c.nextLineTimes[next] {
+			// pick uniformly among all vms due at the same time (reservoir-sampling)
+			candidates++
+			if c.scheduleRand.Intn(candidates) == 0 {
+				next = i
+			}
+		}
+	}
+	if next < 0 {
+		return -1, c.now
+	}
+	c.now = c.nextLineTimes[next]
+	return next, c.now
+}
+
+// lineDone schedules the next line of the vm with the given index
+func (c *Coordinator) lineDone(idx int) {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	c.nextLineTimes[idx] += c.lineInterval(c.vms[idx])
+}
+
+// timeLimitReached returns true if the next line of the vm with the given index would start after the time-limit
+func (c *Coordinator) timeLimitReached(idx int) bool {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	return c.timeLimit > 0 && c.nextLineTimes[idx] >= c.timeLimit
+}
+
+// terminateRunning terminates all vms that have not already terminated
+func (c *Coordinator) terminateRunning() {
+	for _, v := range c.registeredVMs() {
+		if v.State() != StateTerminated {
+			v.Terminate()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestClock(t *testing.T) {
+	coord := vm.NewCoordinator()
+	slow, _ := vm.CreateSyncFromSource(`:order += "s"`)
+	fast, _ := vm.CreateSyncFromSource(`:order += "f"`)
+	for _, v := range []*vm.VM{slow, fast} {
+		v.SetCoordinator(coord)
+		v.Resume()
+	}
+	coord.SetVariable(":order", &vm.Variable{Value: ""})
+	coord.SetLinesPerSecond(fast, 2*vm.DefaultLinesPerSecond)
+	coord.SetTimeLimit(time.Second)
+
+	ticks := 0
+	for coord.Tick() {
+		ticks++
+	}
+
+	order, _ := coord.GetVariable(":order")
+	if order.String() != "sffsffsffsffsff" {
+		t.Fatalf("Wrong order of execution: %s", order.String())
+	}
+	if ticks != 10 {
+		t.Fatalf("Wrong number of ticks: %d", ticks)
+	}
+	if coord.Now() != time.Second {
+		t.Fatalf("Wrong time after running: %s", coord.Now())
+	}
+}
@@ -0,0 +1,426 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// Execution-engines of the vm (see SetEngine)
+const (
+	// EngineInterpreter executes the program by walking the ast. This is the default
+	EngineInterpreter = iota
+	// EngineCompiled compiles the program once into closures before executing it.
+	// Constants are parsed only once and variables are accessed using pre-resolved slots.
+	// Handlers, breakpoints, watchpoints etc. behave exactly like when using EngineInterpreter
+	EngineCompiled
+)
+
+// engineNames maps the names used in config-files and on the command-line to the Engine* constants
+var engineNames = map[string]int{
+	"interpreter": EngineInterpreter,
+	"compiled":    EngineCompiled,
+}
+
+// ParseEngine returns the Engine* constant for the given name ("interpreter" or "compiled").
+// An empty name results in EngineInterpreter
+func ParseEngine(name string) (int, error) {
+	if name == "" {
+		return EngineInterpreter, nil
+	}
+	engine, exists := engineNames[strings.ToLower(name)]
+	if !exists {
+		return 0, fmt.Errorf("Unknown engine '%s'. Available engines are: interpreter, compiled", name)
+	}
+	return engine, nil
+}
+
+// compiledStmt is a statement that has been compiled into a closure
+type compiledStmt func(v *VM) error
+
+// compiledExpr is an expression that has been compiled into a closure
+type compiledExpr func(v *VM) (*Variable, error)
+
+// compiledProgram is a program that has been compiled for EngineCompiled
+type compiledProgram struct {
+	// the compiled statements of every line
+	lines [][]compiledStmt
+	// maps normalized variable-names to slot-indices
+	slots map[string]int
+	// the normalized variable-name of each slot
+	names []string
+	// true for every slot that holds a global variable
+	globals []bool
+}
+
+// binary operations on two numbers, that can be executed without the type-checks of RunBinaryOperation
+var numberBinaryOperations = map[string]func(a, b number.Number) (number.Number, error){
+	"+":  func(a, b number.Number) (number.Number, error) { return a.Add(b), nil },
+	"-":  func(a, b number.Number) (number.Number, error) { return a.Sub(b), nil },
+	"*":  func(a, b number.Number) (number.Number, error) { return a.Mul(b), nil },
+	"/":  func(a, b number.Number) (number.Number, error) { return a.Div(b) },
+	"%":  func(a, b number.Number) (number.Number, error) { return a.Mod(b) },
+	"^":  func(a, b number.Number) (number.Number, error) { return a.Pow(b), nil },
+	"==": func(a, b number.Number) (number.Number, error) { return boolToNumber(a == b), nil },
+	"!=": func(a, b number.Number) (number.Number, error) { return boolToNumber(a != b), nil },
+	">=": func(a, b number.Number) (number.Number, error) { return boolToNumber(a >= b), nil },
+	"<=": func(a, b number.Number) (number.Number, error) { return boolToNumber(a <= b), nil },
+	">":  func(a, b number.Number) (number.Number, error) { return boolToNumber(a > b), nil },
+	"<":  func(a, b number.Number) (number.Number, error) { return boolToNumber(a < b), nil },
+	"and": func(a, b number.Number) (number.Number, error) {
+		return boolToNumber(a != number.Zero && b != number.Zero), nil
+	},
+	"or": func(a, b number.Number) (number.Number, error) {
+		return boolToNumber(a != number.Zero || b != number.Zero), nil
+	},
+}
+
+// unary operations on a number, that can be executed without the type-checks of RunUnaryOperation
+var numberUnaryOperations = map[string]func(a number.Number) number.Number{
+	"-":    func(a number.Number) number.Number { return a.Mul(number.FromInt(-1)) },
+	"not":  func(a number.Number) number.Number { return boolToNumber(a == number.Zero) },
+	"abs":  number.Number.Abs,
+	"sqrt": number.Number.Sqrt,
+	"sin":  number.Number.Sin,
+	"cos":  number.Number.Cos,
+	"tan":  number.Number.Tan,
+	"asin": number.Number.Asin,
+	"acos": number.Number.Acos,
+	"atan": number.Number.Atan,
+}
+
+func boolToNumber(b bool) number.Number {
+	if b {
+		return number.One
+	}
+	return number.Zero
+}
+
+// SetEngine selects the engine that is used to execute the program (one of the Engine* constants).
+// The engine can only be changed before the vm starts executing.
+func (v *VM) SetEngine(engine int) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.started {
+		return fmt.Errorf("Can not change the engine of a vm that has already started execution")
+	}
+	switch engine {
+	case EngineInterpreter:
+		v.compiled = nil
+		v.slots = nil
+	case EngineCompiled:
+		v.compiled = compileProgram(v.program)
+		v.resetSlots()
+	default:
+		return fmt.Errorf("Unknown engine: %d", engine)
+	}
+	return nil
+}
+
+// resetSlots fills the variable-slots of the compiled program with the current local variables
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) resetSlots() {
+	if v.compiled == nil {
+		return
+	}
+	v.slots = make([]*Variable, len(v.compiled.names))
+	for i, name := range v.compiled.names {
+		v.slots[i] = v.variables[name]
+	}
+}
+
+// lookupSlot returns the current value of the variable in the given slot
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) lookupSlot(slot int) (*Variable, bool) {
+	if v.coordinator != nil && v.compiled.globals[slot] {
+		return v.coordinator.getGlobal(v, v.compiled.names[slot])
+	}
+	val := v.slots[slot]
+	return val, val != nil
+}
+
+// readSlot returns the current value of the variable in the given slot. Uninitialized variables have a value of 0
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) readSlot(slot int) *Variable {
+	val, exists := v.lookupSlot(slot)
+	if !exists {
+		return &Variable{
+			number.Zero,
+		}
+	}
+	return val
+}
+
+// writeSlot is the equivalent of writeVariable for compiled code
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) writeSlot(slot int, value *Variable) error {
+	name := v.compiled.names[slot]
+	old, _ := v.lookupSlot(slot)
+	v.recordWrite(name, old, value)
+	v.variables[name] = value
+	v.slots[slot] = value
+	if v.coordinator != nil && v.compiled.globals[slot] {
+		v.coordinator.setGlobal(v, name, value)
+	}
+	return v.notifyWatchpoint(name, old, value)
+}
+
+// compiler compiles an ast.Program into closures
+type compiler struct {
+	prog *compiledProgram
+}
+
+// compileProgram compiles the given program for use with EngineCompiled
+func compileProgram(prog *ast.Program) *compiledProgram {
+	c := &compiler{
+		prog: &compiledProgram{
+			lines:   make([][]compiledStmt, len(prog.Lines)),
+			slots:   make(map[string]int),
+			names:   make([]string, 0),
+			globals: make([]bool, 0),
+		},
+	}
+	for i, line := range prog.Lines {
+		c.prog.lines[i] = c.compileBlock(line.Statements)
+	}
+	return c.prog
+}
+
+// slot returns the slot-index for the given variable. A new slot is created if necessary
+func (c *compiler) slot(name string) int {
+	name = strings.ToLower(name)
+	if idx, exists := c.prog.slots[name]; exists {
+		return idx
+	}
+	idx := len(c.prog.names)
+	c.prog.slots[name] = idx
+	c.prog.names = append(c.prog.names, name)
+	c.prog.globals = append(c.prog.globals, strings.HasPrefix(name, ":"))
+	return idx
+}
+
+func (c *compiler) compileBlock(stmts []ast.Statement) []compiledStmt {
+	compiled := make([]compiledStmt, len(stmts))
+	for i, stmt := range stmts {
+		compiled[i] = c.compileStmt(stmt)
+	}
+	return compiled
+}
+
+// compileStmt compiles a statement. The compiled statement behaves exactly like VM.runStmt
+func (c *compiler) compileStmt(stmt ast.Statement) compiledStmt {
+	body := c.compileStmtBody(stmt)
+	return func(v *VM) error {
+		err := v.enterStmt(stmt)
+		if err != nil {
+			return err
+		}
+		return body(v)
+	}
+}
+
+func (c *compiler) compileStmtBody(stmt ast.Statement) compiledStmt {
+	switch e := stmt.(type) {
+	case *ast.Assignment:
+		return c.compileAssignment(e)
+	case *ast.IfStatement:
+		condition := c.compileExpr(e.Condition)
+		ifBlock := c.compileBlock(e.IfBlock)
+		var elseBlock []compiledStmt
+		if e.ElseBlock != nil {
+			elseBlock = c.compileBlock(e.ElseBlock)
+		}
+		return func(v *VM) error {
+			conditionResult, err := condition(v)
+			if err != nil {
+				return err
+			}
+			cond, err := checkCondition(e, conditionResult)
+			if err != nil {
+				return err
+			}
+			v.countBranch(e, cond)
+			block := elseBlock
+			if cond {
+				block = ifBlock
+			}
+			for _, st := range block {
+				err := st(v)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case *ast.GoToStatement:
+		target := c.compileExpr(e.Line)
+		return func(v *VM) error {
+			line, err := target(v)
+			if err != nil {
+				if _, isRuntimeErr := err.(RuntimeError); isRuntimeErr {
+					return err
+				}
+				return RuntimeError{
+					Base: err,
+					Node: stmt,
+					Kind: ErrKindOther,
+				}
+			}
+			return v.gotoLine(e, line)
+		}
+	case *ast.Dereference:
+		deref := c.compileDeref(e)
+		return func(v *VM) error {
+			_, err := deref(v)
+			return err
+		}
+	default:
+		return func(v *VM) error {
+			return RuntimeError{
+				Base: fmt.Errorf("UNKNWON-STATEMENT:%T", e),
+				Node: stmt,
+				Kind: ErrKindOther,
+			}
+		}
+	}
+}
+
+func (c *compiler) compileAssignment(as *ast.Assignment) compiledStmt {
+	var value compiledExpr
+	if as.Operator != "=" {
+		value = c.compileBinOp(&ast.BinaryOperation{
+			Exp1: &ast.Dereference{
+				Variable: as.Variable,
+				Position: as.Start(),
+			},
+			Exp2:     as.Value,
+			Operator: strings.Replace(as.Operator, "=", "", -1),
+		})
+	} else {
+		value = c.compileExpr(as.Value)
+	}
+	slot := c.slot(as.Variable)
+	return func(v *VM) error {
+		newValue, err := value(v)
+		if err != nil {
+			return err
+		}
+		return v.writeSlot(slot, newValue)
+	}
+}
+
+// compileExpr compiles an expression. The compiled expression behaves exactly like VM.runExpr
+func (c *compiler) compileExpr(expr ast.Expression) compiledExpr {
+	switch e := expr.(type) {
+	case *ast.StringConstant:
+		constant := &Variable{Value: e.Value}
+		return func(v *VM) (*Variable, error) {
+			return constant, nil
+		}
+	case *ast.NumberConstant:
+		num, err := number.FromString(e.Value)
+		if err != nil {
+			return func(v *VM) (*Variable, error) {
+				return nil, err
+			}
+		}
+		constant := &Variable{Value: num}
+		return func(v *VM) (*Variable, error) {
+			return constant, nil
+		}
+	case *ast.BinaryOperation:
+		return c.compileBinOp(e)
+	case *ast.UnaryOperation:
+		return c.compileUnaryOp(e)
+	case *ast.Dereference:
+		return c.compileDeref(e)
+	default:
+		return func(v *VM) (*Variable, error) {
+			return nil, RuntimeError{
+				Base: fmt.Errorf("UNKNWON-EXPRESSION:%T", e),
+				Node: expr,
+				Kind: ErrKindOther,
+			}
+		}
+	}
+}
+
+func (c *compiler) compileDeref(d *ast.Dereference) compiledExpr {
+	slot := c.slot(d.Variable)
+	if d.Operator == "" {
+		return func(v *VM) (*Variable, error) {
+			return v.readSlot(slot), nil
+		}
+	}
+	pre := d.PrePost == "Pre"
+	return func(v *VM) (*Variable, error) {
+		oldval := v.readSlot(slot)
+		newval, err := applyDerefOperator(d, oldval)
+		if err != nil {
+			return nil, err
+		}
+		err = v.writeSlot(slot, newval)
+		if err != nil {
+			return nil, err
+		}
+		if pre {
+			return newval, nil
+		}
+		return oldval, nil
+	}
+}
+
+func (c *compiler) compileBinOp(op *ast.BinaryOperation) compiledExpr {
+	exp1 := c.compileExpr(op.Exp1)
+	exp2 := c.compileExpr(op.Exp2)
+	numberOperation := numberBinaryOperations[op.Operator]
+	return func(v *VM) (*Variable, error) {
+		arg1, err := exp1(v)
+		if err != nil {
+			return nil, err
+		}
+		arg2, err := exp2(v)
+		if err != nil {
+			return nil, err
+		}
+		if numberOperation != nil {
+			num1, isNum1 := arg1.Value.(number.Number)
+			num2, isNum2 := arg2.Value.(number.Number)
+			if isNum1 && isNum2 {
+				result, err := numberOperation(num1, num2)
+				if err != nil {
+					return nil, binaryOperationError(op, arg1, arg2, err)
+				}
+				return &Variable{Value: result}, nil
+			}
+		}
+		result, err := RunBinaryOperation(arg1, arg2, op.Operator)
+		if err != nil {
+			return nil, binaryOperationError(op, arg1, arg2, err)
+		}
+		return result, nil
+	}
+}
+
+func (c *compiler) compileUnaryOp(op *ast.UnaryOperation) compiledExpr {
+	exp := c.compileExpr(op.Exp)
+	numberOperation := numberUnaryOperations[strings.ToLower(op.Operator)]
+	return func(v *VM) (*Variable, error) {
+		arg, err := exp(v)
+		if err != nil {
+			return nil, err
+		}
+		if numberOperation != nil {
+			if num, isNum := arg.Value.(number.Number); isNum {
+				return &Variable{Value: numberOperation(num)}, nil
+			}
+		}
+		result, err := RunUnaryOperation(arg, op.Operator)
+		if err != nil {
+			return nil, unaryOperationError(op, arg, err)
+		}
+		return result, nil
+	}
+}
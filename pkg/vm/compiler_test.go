@@ -0,0 +1,130 @@
+package vm_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/testdata"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestCompiledOperators(t *testing.T) {
+	err := testdata.ExecuteTestProgramWithEngine(testdata.TestProgram, vm.EngineCompiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompiledStatementStepping(t *testing.T) {
+	testStatementStepping(t, vm.EngineCompiled)
+}
+
+func TestCompiledMatchesInterpreter(t *testing.T) {
+	prog1 := `s = "hello" n = 1 :out = ""
+n *= 3 n++ m = n-- + ++n s -= "l" s += n
+if n > 2 and not (m == 0) then :out += s else :out = "x" end
+x = 1/0 y = 2
+z = "abc" z-- z-- z-- z--
+if :in then :count++ end goto 2
+`
+	prog2 := `:in = :in == 0
+:count -= 2
+`
+	interpretedVars, interpretedErrs := runOnEngine(t, vm.EngineInterpreter, 50, prog1, prog2)
+	compiledVars, compiledErrs := runOnEngine(t, vm.EngineCompiled, 50, prog1, prog2)
+
+	if fmt.Sprint(interpretedVars) != fmt.Sprint(compiledVars) {
+		t.Fatalf("Different variables. Interpreter: %v, compiled: %v", interpretedVars, compiledVars)
+	}
+	if fmt.Sprint(interpretedErrs) != fmt.Sprint(compiledErrs) {
+		t.Fatalf("Different errors. Interpreter: %v, compiled: %v", interpretedErrs, compiledErrs)
+	}
+	if len(interpretedErrs) == 0 {
+		t.Fatal("The program should have produced runtime-errors")
+	}
+}
+
+func TestCompiledMatchesInterpreterExamples(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "examples", "yolol", "*.yolol"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("No example-scripts found", err)
+	}
+	progs := map[string]string{
+		"testdata": testdata.TestProgram,
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		progs[file] = string(content)
+	}
+
+	for name, prog := range progs {
+		interpretedVars, interpretedErrs := runOnEngine(t, vm.EngineInterpreter, 500, prog)
+		compiledVars, compiledErrs := runOnEngine(t, vm.EngineCompiled, 500, prog)
+		if fmt.Sprint(interpretedVars) != fmt.Sprint(compiledVars) {
+			t.Errorf("Different variables for %s. Interpreter: %v, compiled: %v", name, interpretedVars, compiledVars)
+		}
+		if fmt.Sprint(interpretedErrs) != fmt.Sprint(compiledErrs) {
+			t.Errorf("Different errors for %s. Interpreter: %v, compiled: %v", name, interpretedErrs, compiledErrs)
+		}
+	}
+}
+
+// runOnEngine runs the given programs on a coordinator using the given engine, until each of them executed maxLines lines.
+// Returns the variables of all vms (prefixed by the index of the vm) and the errors that occured
+func runOnEngine(t *testing.T, engine int, maxLines int, progs ...string) (map[string]vm.Variable, []string) {
+	coord := vm.NewCoordinator()
+	errs := make([]string, 0)
+	vms := make([]*vm.VM, len(progs))
+	for i, prog := range progs {
+		v, err := vm.CreateFromSource(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.SetEngine(engine)
+		v.SetCoordinator(coord)
+		v.SetMaxExecutedLines(maxLines)
+		v.SetErrorHandler(func(x *vm.VM, err error) {
+			errs = append(errs, err.Error())
+		})
+		v.SetErrorMode(vm.ErrorModeAbortLine)
+		v.Resume()
+		vms[i] = v
+	}
+	coord.Run()
+	coord.WaitForTermination()
+	vars := make(map[string]vm.Variable)
+	for i, v := range vms {
+		for name, value := range v.GetVariables() {
+			vars[fmt.Sprintf("%d/%s", i+1, name)] = value
+		}
+	}
+	return vars, errs
+}
+
+func BenchmarkInterpreter(b *testing.B) {
+	benchmarkEngine(b, vm.EngineInterpreter)
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	benchmarkEngine(b, vm.EngineCompiled)
+}
+
+func benchmarkEngine(b *testing.B, engine int) {
+	prog := `a = 0 b = 1.5 s = "abc"
+a += b * 2 - 1 b = b % 7 + 0.25 s += "d" s -= "d"
+if a > 1000 then a = 0 end :x = a + b
+goto 2
+`
+	for i := 0; i < b.N; i++ {
+		v, _ := vm.CreateFromSource(prog)
+		v.SetEngine(engine)
+		v.SetMaxExecutedLines(10000)
+		v.Resume()
+		v.WaitForTermination()
+	}
+}
@@ -1,8 +1,9 @@
 package vm
 
 import (
-	"strings"
+	"math/rand"
 	"sync"
+	"time"
 )
 
 // Coordinator is responsible for coordinating the execution of multiple VMs
@@ -11,8 +12,46 @@ type Coordinator struct {
 	vms              []*VM
 	runLineChannels  []chan struct{}
 	lineDoneChannels []chan struct{}
-	globalVariables  map[string]*Variable
-	varLock          *sync.Mutex
+	// the global variables of each data-network
+	networks map[string]map[string]*Variable
+	// the networks each vm is connected to. Vms without entry are connected to DefaultNetwork
+	vmNetworks map[*VM][]string
+	// bridges forwarding variables between networks
+	bridges []Bridge
+	// per vm: maps the names of globals used in the script to the names of the accessed globals
+	aliases map[*VM]map[string]string
+	// the watched variables (qualified names)
+	watchpoints map[string]bool
+	varLock     *sync.Mutex
+	vmLock      *sync.Mutex
+	// the simulated time at which each vm runs its next line. Indexed like vms
+	nextLineTimes []time.Duration
+	// the simulated time between two lines of a vm. Vms without entry run at DefaultLinesPerSecond
+	lineIntervals map[*VM]time.Duration
+	// the current simulated time
+	now time.Duration
+	// if > 0, all vms are terminated once the simulated time reaches this limit
+	timeLimit time.Duration
+	// if set, vms that are due at the same time are run in a random order
+	scheduleRand *rand.Rand
+	// the devices connected to the coordinator
+	devices []connectedDevice
+	// maps the qualified names of device-fields to the device owning the field
+	deviceFields map[string]connectedDevice
+	// the simulated time of the last device-update
+	devicesUpdated time.Duration
+	// detects when all vms are idle. nil if disabled
+	idle *idleDetector
+	// functions that are called later in the run, ordered by time
+	scheduledCalls []scheduledCall
+	// the scheduled function that has been called most recently. nil if none has been called yet
+	lastCall *scheduledCall
+	// the vm that currently holds the permission to run a line. nil if there is none
+	holder *VM
+	// true if the holder gave back its permission without running a line (see returnPermission())
+	returned bool
+	// signals the coordinator to choose again which vm runs next, because the schedule has been changed
+	rescheduled chan struct{}
 }
 
 // NewCoordinator returns a new coordinator
@@ -21,8 +60,19 @@ func NewCoordinator() *Coordinator {
 		vms:              make([]*VM, 0),
 		runLineChannels:  make([]chan struct{}, 0),
 		lineDoneChannels: make([]chan struct{}, 0),
-		globalVariables:  make(map[string]*Variable),
+		networks:         map[string]map[string]*Variable{DefaultNetwork: make(map[string]*Variable)},
+		vmNetworks:       make(map[*VM][]string),
+		bridges:          make([]Bridge, 0),
+		aliases:          make(map[*VM]map[string]string),
+		watchpoints:      make(map[string]bool),
 		varLock:          &sync.Mutex{},
+		vmLock:           &sync.Mutex{},
+		nextLineTimes:    make([]time.Duration, 0),
+		lineIntervals:    make(map[*VM]time.Duration),
+		devices:          make([]connectedDevice, 0),
+		deviceFields:     make(map[string]connectedDevice),
+		scheduledCalls:   make([]scheduledCall, 0),
+		rescheduled:      make(chan struct{}, 1),
 	}
 }
 
@@ -35,52 +85,85 @@ func (c *Coordinator) Run() {
 // Terminate all coordinated vms
 // Once all VMs terminate the coordinator-goroutine will also shut-down
 func (c *Coordinator) Terminate() {
-	for _, v := range c.vms {
+	for _, v := range c.registeredVMs() {
 		v.Terminate()
 	}
 }
 
 // WaitForTermination blocks until all coordinated vms terminate
 func (c *Coordinator) WaitForTermination() {
-	for _, v := range c.vms {
+	for _, v := range c.registeredVMs() {
 		v.WaitForTermination()
 	}
 }
 
 // GetVariable gets the current state of a global variable
-// getting variables is case-insensitive
+// getting variables is case-insensitive. Variables of networks other than the default network
+// are addressed using their qualified name (see QualifiedName())
 func (c *Coordinator) GetVariable(name string) (*Variable, bool) {
-	name = strings.ToLower(name)
+	network, name := SplitQualifiedName(name)
 	c.varLock.Lock()
 	defer c.varLock.Unlock()
-	val, exists := c.globalVariables[name]
+	val, exists := c.networks[network][name]
 	return val, exists
 }
 
-// GetVariables gets the current state of all global variables
-// All returned variables have normalized (lowercased) names
+// GetVariables gets the current state of all global variables of all networks
+// All returned variables have normalized (lowercased) and qualified names (see QualifiedName())
 func (c *Coordinator) GetVariables() map[string]Variable {
 	c.varLock.Lock()
 	defer c.varLock.Unlock()
 	varlist := make(map[string]Variable)
-	for key, value := range c.globalVariables {
-		varlist[key] = Variable{
-			Value: value.Value,
+	for network, vars := range c.networks {
+		for key, value := range vars {
+			varlist[QualifiedName(network, key)] = Variable{
+				Value: value.Value,
+			}
 		}
 	}
 	return varlist
 }
 
-// SetVariable sets the current state of a global variable
-// setting variables is case-insensitive
+// SetVariable sets the current state of a global variable. The value is forwarded over bridges.
+// setting variables is case-insensitive. Variables of networks other than the default network
+// are addressed using their qualified name (see QualifiedName())
 func (c *Coordinator) SetVariable(name string, value *Variable) error {
-	name = strings.ToLower(name)
+	network, name := SplitQualifiedName(name)
+	written := make(map[string]bool)
 	c.varLock.Lock()
-	defer c.varLock.Unlock()
-	c.globalVariables[name] = value
+	c.store(network, name, value, written)
+	c.varLock.Unlock()
+	c.notifyDevices(name, value, written, "")
 	return nil
 }
 
+// AddWatchpoint adds a watchpoint for the given global variable.
+// Whenever any of the coordinated vms writes to the variable, the watchpoint-handler of this vm is called.
+// As the vms run line by line, pausing the writing vm halts all coordinated vms.
+func (c *Coordinator) AddWatchpoint(name string) {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	c.watchpoints[QualifiedName(SplitQualifiedName(name))] = true
+}
+
+// RemoveWatchpoint removes the watchpoint for the given global variable
+func (c *Coordinator) RemoveWatchpoint(name string) {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	delete(c.watchpoints, QualifiedName(SplitQualifiedName(name)))
+}
+
+// ListWatchpoints returns the names of all watched global variables
+func (c *Coordinator) ListWatchpoints() []string {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	li := make([]string, 0, len(c.watchpoints))
+	for k := range c.watchpoints {
+		li = append(li, k)
+	}
+	return li
+}
+
 // registerVM registers a VM with the coordinator
 // is called by the vm in SetCoordinator.
 // returns two channels. The first is used to signal to the VM that it may run a line
@@ -89,43 +172,99 @@ func (c *Coordinator) SetVariable(name string, value *Variable) error {
 func (c *Coordinator) registerVM(vm *VM) (<-chan struct{}, chan<- struct{}) {
 	runChannel := make(chan struct{})
 	doneChannel := make(chan struct{})
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
 	c.vms = append(c.vms, vm)
 	c.runLineChannels = append(c.runLineChannels, runChannel)
 	c.lineDoneChannels = append(c.lineDoneChannels, doneChannel)
+	c.nextLineTimes = append(c.nextLineTimes, c.now)
 	return runChannel, doneChannel
 }
 
+// registeredVMs returns a copy of the list of currently coordinated vms
+func (c *Coordinator) registeredVMs() []*VM {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	vms := make([]*VM, len(c.vms))
+	copy(vms, c.vms)
+	return vms
+}
+
 // remove a VM from the coordination
 // execurted once a VM closes it's done-channel
 func (c *Coordinator) remove(idx int) {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
 	c.vms = append(c.vms[:idx], c.vms[idx+1:]...)
 	close(c.runLineChannels[idx])
 	c.runLineChannels = append(c.runLineChannels[:idx], c.runLineChannels[idx+1:]...)
 	c.lineDoneChannels = append(c.lineDoneChannels[:idx], c.lineDoneChannels[idx+1:]...)
+	c.nextLineTimes = append(c.nextLineTimes[:idx], c.nextLineTimes[idx+1:]...)
 }
 
 func (c *Coordinator) run() {
 	for {
-		for i := 0; i < len(c.runLineChannels); i++ {
-			runch := c.runLineChannels[i]
-			donech := c.lineDoneChannels[i]
-
-			select {
-			case runch <- struct{}{}:
-				// the vm resceived the permission to run. Continue execution normally
-			case <-donech:
-				// the client closed the donechannel. This means he does not longer participate in coordination
-				c.remove(i)
-				continue
-			}
+		i, _ := c.nextScheduled(false)
+		if i < 0 {
+			return
+		}
+		c.updateDevices()
+		c.runScheduledCalls()
+		if c.timeLimitReached(i) {
+			c.terminateRunning()
+		}
 
-			_, open := <-donech
-			if !open {
-				c.remove(i)
-			}
+		c.vmLock.Lock()
+		v := c.vms[i]
+		runch := c.runLineChannels[i]
+		donech := c.lineDoneChannels[i]
+		c.vmLock.Unlock()
+
+		select {
+		case runch <- struct{}{}:
+			// the vm resceived the permission to run. Continue execution normally
+		case <-donech:
+			// the client closed the donechannel. This means he does not longer participate in coordination
+			c.remove(i)
+			continue
+		case <-c.rescheduled:
+			// the schedule has been changed (e.g. by reverting lines). Choose again
+			continue
 		}
-		if len(c.vms) == 0 {
-			return
+		c.setHolder(v)
+
+		_, open := <-donech
+		if !open {
+			c.setHolder(nil)
+			c.remove(i)
+			continue
+		}
+		if c.setHolder(nil) {
+			// the vm did not run its line
+			continue
+		}
+		c.lineDone(i)
+		if c.checkIdle(v) {
+			c.terminateRunning()
 		}
 	}
 }
+
+// setHolder sets the vm that holds the permission to run a line.
+// Returns true if the previous holder gave back its permission without running a line
+func (c *Coordinator) setHolder(v *VM) bool {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	returned := c.returned
+	c.holder = v
+	c.returned = false
+	return returned
+}
+
+// returnPermission is called by the holder of the permission right before it signals that it is done,
+// if it did not use the permission to run a line
+func (c *Coordinator) returnPermission() {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	c.returned = true
+}
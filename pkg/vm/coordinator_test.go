@@ -53,3 +53,45 @@ func TestCoordinatedExecution(t *testing.T) {
 		t.Fatalf("Wrong result for computation, wanted %s but got %s", "abcdefgh", result1)
 	}
 }
+
+func TestGlobalWatchpoint(t *testing.T) {
+	prog1 := `:a = 1
+:a = 2
+`
+	prog2 := `:x = 1
+:x += 2
+`
+	coord := vm.NewCoordinator()
+	vm1, _ := vm.CreateFromSource(prog1)
+	vm2, _ := vm.CreateFromSource(prog2)
+
+	writes := make([]string, 0)
+	handler := func(v *vm.VM, name string, old *vm.Variable, new *vm.Variable) bool {
+		oldRepr := "<none>"
+		if old != nil {
+			oldRepr = old.Repr()
+		}
+		writes = append(writes, fmt.Sprintf("%v %s %s->%s", v == vm2, name, oldRepr, new.Repr()))
+		return true
+	}
+
+	for _, v := range []*vm.VM{vm1, vm2} {
+		v.SetCoordinator(coord)
+		v.SetWatchpointHandler(handler)
+		v.SetMaxExecutedLines(2)
+	}
+	coord.AddWatchpoint(":X")
+
+	vm1.Resume()
+	vm2.Resume()
+	coord.Run()
+	coord.WaitForTermination()
+
+	expected := []string{
+		"true :x <none>->1",
+		"true :x 1->3",
+	}
+	if fmt.Sprint(writes) != fmt.Sprint(expected) {
+		t.Fatalf("Wrong watchpoint-hits. Wanted %v but got %v", expected, writes)
+	}
+}
@@ -0,0 +1,150 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Device simulates a device (like a button, a lamp or a hinge) that is connected to the coordinated vms.
+// A device owns a set of fields. The fields are stored as global variables, so scripts can read and write them.
+type Device interface {
+	// Fields returns the names (including the ':' prefix) and initial values of the fields owned by the device
+	Fields() map[string]*Variable
+	// OnWrite is called after one of the fields of the device has been written. now is the current simulated time
+	OnWrite(field string, value *Variable, now time.Duration)
+	// Update is called whenever the simulated time advances. It returns the fields whose values changed
+	Update(now time.Duration) map[string]*Variable
+}
+
+// ActiveDevice is implemented by devices that change their fields on their own (like a moving hinge).
+// Such devices can have an internal state that is more precise than their fields, so the vms are never considered
+// idle while one of them is active (see EnableIdleDetection())
+type ActiveDevice interface {
+	Device
+	// Active returns true if the device will change its fields without further writes
+	Active() bool
+}
+
+// connectedDevice is a device together with the network it is connected to
+type connectedDevice struct {
+	device  Device
+	network string
+}
+
+// AddDevice connects the device to the default network of the coordinator. See AddNetworkDevice()
+func (c *Coordinator) AddDevice(d Device) error {
+	return c.AddNetworkDevice(DefaultNetwork, d)
+}
+
+// AddNetworkDevice connects the device to the given network. The fields of the device are initialized with their initial values.
+// Returns an error if one of the fields is already owned by another device on the network.
+// Devices MUST be added before calling Run() or Tick()
+func (c *Coordinator) AddNetworkDevice(network string, d Device) error {
+	network = normalizeNetwork(network)
+	// devices connected after restoring a snapshot start at the restored simulated time
+	if now := c.Now(); now > 0 {
+		d.Update(now)
+	}
+	fields := d.Fields()
+
+	c.varLock.Lock()
+	for name := range fields {
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, ":") {
+			c.varLock.Unlock()
+			return fmt.Errorf("The device-field '%s' must be a global variable", name)
+		}
+		if _, exists := c.deviceFields[QualifiedName(network, name)]; exists {
+			c.varLock.Unlock()
+			return fmt.Errorf("The field '%s' is already owned by another device", QualifiedName(network, name))
+		}
+	}
+	connected := connectedDevice{
+		device:  d,
+		network: network,
+	}
+	for name := range fields {
+		c.deviceFields[QualifiedName(network, name)] = connected
+	}
+	c.devices = append(c.devices, connected)
+	c.varLock.Unlock()
+
+	for name, value := range fields {
+		c.storeDeviceField(connected, strings.ToLower(name), value)
+	}
+	return nil
+}
+
+// Devices returns the devices connected to the coordinator
+func (c *Coordinator) Devices() []Device {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	devices := make([]Device, len(c.devices))
+	for i, connected := range c.devices {
+		devices[i] = connected.device
+	}
+	return devices
+}
+
+// notifyDevices informs the devices owning the written variable about the write.
+// written contains the networks the variable has been written to. The network skip is ignored
+func (c *Coordinator) notifyDevices(name string, value *Variable, written map[string]bool, skip string) {
+	if value == nil {
+		return
+	}
+	notify := make([]Device, 0, 1)
+	c.varLock.Lock()
+	for network := range written {
+		if connected, exists := c.deviceFields[QualifiedName(network, name)]; exists && network != skip {
+			notify = append(notify, connected.device)
+		}
+	}
+	c.varLock.Unlock()
+	if len(notify) == 0 {
+		return
+	}
+	now := c.Now()
+	for _, d := range notify {
+		d.OnWrite(name, value, now)
+	}
+}
+
+// storeDeviceField stores a field-value reported by a device and forwards it over the bridges
+func (c *Coordinator) storeDeviceField(connected connectedDevice, name string, value *Variable) {
+	written := make(map[string]bool)
+	c.varLock.Lock()
+	c.store(connected.network, name, value, written)
+	c.varLock.Unlock()
+	c.notifyDevices(name, value, written, connected.network)
+}
+
+// devicesActive returns true if at least one of the connected devices is an active ActiveDevice
+func (c *Coordinator) devicesActive() bool {
+	for _, d := range c.Devices() {
+		if active, is := d.(ActiveDevice); is && active.Active() {
+			return true
+		}
+	}
+	return false
+}
+
+// updateDevices lets all devices update their fields, if the simulated time advanced since the last update
+func (c *Coordinator) updateDevices() {
+	now := c.Now()
+	c.varLock.Lock()
+	if now <= c.devicesUpdated {
+		c.varLock.Unlock()
+		return
+	}
+	c.devicesUpdated = now
+	devices := make([]connectedDevice, len(c.devices))
+	copy(devices, c.devices)
+	c.varLock.Unlock()
+
+	for _, connected := range devices {
+		for name, value := range connected.device.Update(now) {
+			c.storeDeviceField(connected, strings.ToLower(name), value)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// testDevice counts the elapsed steps of 200ms and remembers the last value written to :target
+type testDevice struct {
+	written *vm.Variable
+}
+
+func (d *testDevice) Fields() map[string]*vm.Variable {
+	zero, _ := vm.VariableFromType(0)
+	return map[string]*vm.Variable{
+		":steps":  zero,
+		":target": zero,
+	}
+}
+
+func (d *testDevice) OnWrite(field string, value *vm.Variable, now time.Duration) {
+	if field == ":target" {
+		d.written = value
+	}
+}
+
+func (d *testDevice) Update(now time.Duration) map[string]*vm.Variable {
+	steps, _ := vm.VariableFromType(int(now / (200 * time.Millisecond)))
+	return map[string]*vm.Variable{
+		":steps": steps,
+	}
+}
+
+func TestDevice(t *testing.T) {
+	coord := vm.NewCoordinator()
+	device := &testDevice{}
+	err := coord.AddDevice(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = coord.AddDevice(&testDevice{})
+	if err == nil {
+		t.Fatal("Adding a device with already owned fields should fail")
+	}
+
+	v, _ := vm.CreateSyncFromSource(`:copy = :steps :target = :copy * 2`)
+	v.SetCoordinator(coord)
+	v.Resume()
+	coord.SetTimeLimit(time.Second)
+	for coord.Tick() {
+	}
+
+	copied, _ := coord.GetVariable(":copy")
+	if copied.Itoa() != "4" {
+		t.Fatalf("Wrong value read from the device: %s", copied.Repr())
+	}
+	if device.written == nil || device.written.Itoa() != "8" {
+		t.Fatalf("The device did not receive the last write: %v", device.written)
+	}
+}
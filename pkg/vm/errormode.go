@@ -0,0 +1,68 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reactions of the vm to runtime-errors (see SetErrorMode)
+const (
+	// ErrorModeHalt aborts the current line and terminates the vm. This is the default of a new vm
+	ErrorModeHalt = iota
+	// ErrorModeAbortLine aborts the rest of the current line and continues with the next line.
+	// This is what a chip in Starbase does
+	ErrorModeAbortLine
+	// ErrorModePause aborts the current line and pauses the vm. Once resumed, execution continues with the next line
+	ErrorModePause
+)
+
+// errorModeNames maps the names used in config-files to the ErrorMode* constants
+var errorModeNames = map[string]int{
+	"abortline": ErrorModeAbortLine,
+	"halt":      ErrorModeHalt,
+	"pause":     ErrorModePause,
+}
+
+// ParseErrorMode returns the ErrorMode* constant for the given name ("abortline", "halt" or "pause").
+// An empty name results in ErrorModeAbortLine, the default for tests and debugging
+func ParseErrorMode(name string) (int, error) {
+	if name == "" {
+		return ErrorModeAbortLine, nil
+	}
+	mode, exists := errorModeNames[strings.ToLower(name)]
+	if !exists {
+		return 0, fmt.Errorf("Unknown error-mode '%s'. Available modes are: abortline, halt, pause", name)
+	}
+	return mode, nil
+}
+
+// SetErrorMode sets how the vm reacts to runtime-errors (one of the ErrorMode* constants).
+// This also resets all modes set using SetErrorModeForKind().
+// The error-handler (see SetErrorHandler()) is called for every error, regardless of the mode
+func (v *VM) SetErrorMode(mode int) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.errorMode = mode
+	v.kindErrorModes = make(map[string]int)
+}
+
+// SetErrorModeForKind sets how the vm reacts to runtime-errors of the given kind (one of the ErrKind* constants).
+// Errors of other kinds use the mode set by SetErrorMode()
+func (v *VM) SetErrorModeForKind(kind string, mode int) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.kindErrorModes[kind] = mode
+}
+
+// errorModeFor returns the reaction to the given error
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) errorModeFor(err error) int {
+	kind := ErrKindOther
+	if rerr, is := err.(RuntimeError); is {
+		kind = rerr.Kind
+	}
+	if mode, exists := v.kindErrorModes[kind]; exists {
+		return mode
+	}
+	return v.errorMode
+}
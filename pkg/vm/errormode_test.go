@@ -0,0 +1,84 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+const errorModeProg = `a = 1 b = 1/0 c = 1
+d = "x" * 2 e = 1
+f = 1`
+
+func TestErrorModes(t *testing.T) {
+	tests := []struct {
+		mode     int
+		executed int
+		errors   int
+		state    int
+		vars     []string
+	}{
+		{vm.ErrorModeAbortLine, 3, 2, vm.StateRunning, []string{"a", "f"}},
+		{vm.ErrorModeHalt, 0, 1, vm.StateTerminated, []string{"a"}},
+		{vm.ErrorModePause, 1, 1, vm.StatePaused, []string{"a"}},
+	}
+	// a line aborted by halting the vm does not count as executed
+	for _, test := range tests {
+		v, err := vm.CreateSyncFromSource(errorModeProg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := 0
+		v.SetErrorHandler(func(x *vm.VM, err error) {
+			errs++
+		})
+		v.SetErrorMode(test.mode)
+		v.Resume()
+		executed, err := v.RunLines(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if executed != test.executed || v.State() != test.state {
+			t.Fatalf("Mode %d: expected %d executed lines and state %d, but got %d and %d", test.mode, test.executed, test.state, executed, v.State())
+		}
+		if errs != test.errors {
+			t.Fatalf("Mode %d: the error-handler has been called %d times", test.mode, errs)
+		}
+		for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+			_, exists := v.GetVariable(name)
+			expected := false
+			for _, set := range test.vars {
+				expected = expected || set == name
+			}
+			if exists != expected {
+				t.Fatalf("Mode %d: variable %s exists: %v, expected: %v", test.mode, name, exists, expected)
+			}
+		}
+	}
+
+	// without an error-mode, the vm halts
+	v, _ := vm.CreateSyncFromSource(errorModeProg)
+	v.Resume()
+	executed, _ := v.RunLines(3)
+	if executed != 0 || v.State() != vm.StateTerminated {
+		t.Fatalf("A new vm should halt on the first error. Executed: %d", executed)
+	}
+}
+
+func TestErrorModeForKind(t *testing.T) {
+	v, err := vm.CreateSyncFromSource(errorModeProg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetErrorMode(vm.ErrorModeAbortLine)
+	v.SetErrorModeForKind(vm.ErrKindTypeMismatch, vm.ErrorModeHalt)
+	v.Resume()
+	executed, _ := v.RunLines(3)
+	if executed != 1 || v.State() != vm.StateTerminated {
+		t.Fatalf("The division by zero should have been skipped and the type-mismatch should have halted the vm. Executed: %d", executed)
+	}
+
+	if _, err := vm.ParseErrorMode("explode"); err == nil {
+		t.Fatal("Unknown error-modes must be rejected")
+	}
+}
@@ -0,0 +1,40 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// Evaluate parses the given yolol-expression and evaluates it using the current variables of the vm
+// (and the global variables of the coordinator, if there is one).
+// The evaluation has no side-effects. Expressions containing ++ or -- are rejected.
+func (v *VM) Evaluate(expr string) (*Variable, error) {
+	parsed, err := parser.NewParser().ParseExpressionString(expr)
+	if err != nil {
+		return nil, err
+	}
+	return v.EvaluateExpression(parsed)
+}
+
+// EvaluateExpression works like Evaluate, but receives an already parsed expression
+func (v *VM) EvaluateExpression(expr ast.Expression) (*Variable, error) {
+	err := checkSideEffects(expr)
+	if err != nil {
+		return nil, err
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.runExpr(expr)
+}
+
+// checkSideEffects returns an error if evaluating the expression would modify variables
+func checkSideEffects(expr ast.Expression) error {
+	return expr.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is && deref.Operator != "" {
+			return fmt.Errorf("The expression can not contain ++ or --")
+		}
+		return nil
+	}))
+}
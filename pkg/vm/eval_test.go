@@ -0,0 +1,46 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestEvaluate(t *testing.T) {
+	coord := vm.NewCoordinator()
+	v, _ := vm.CreateFromSource(`a = 3 b = "abc" :x = 4`)
+	v.SetCoordinator(coord)
+	paused := make(chan struct{})
+	v.SetLineExecutedHandler(func(x *vm.VM) bool {
+		close(paused)
+		return false
+	})
+	v.Resume()
+	coord.Run()
+	<-paused
+
+	cases := map[string]string{
+		"a * 2 + :x":  "10",
+		"b + \"def\"": "\"abcdef\"",
+		"undefined":   "0",
+		"a > 2":       "1",
+	}
+	for expr, want := range cases {
+		result, err := v.Evaluate(expr)
+		if err != nil {
+			t.Fatalf("Error when evaluating '%s': %s", expr, err)
+		}
+		if result.Repr() != want {
+			t.Fatalf("Wrong result for '%s'. Wanted %s but got %s", expr, want, result.Repr())
+		}
+	}
+
+	if _, err := v.Evaluate("a++"); err == nil {
+		t.Fatal("Expressions with side-effects should be rejected")
+	}
+	a, _ := v.GetVariable("a")
+	if a.Itoa() != "3" {
+		t.Fatalf("Evaluating changed the value of a to %s", a.Itoa())
+	}
+	v.Terminate()
+}
@@ -0,0 +1,89 @@
+package vm
+
+import (
+	"sort"
+	"time"
+)
+
+// scheduledCall is a function that is called at a given simulated time
+type scheduledCall struct {
+	at time.Duration
+	// if true, the function is called after the lines that are due at the time, instead of before them
+	afterLines bool
+	f          func()
+}
+
+// due returns true if the call has to be made before lines that are due at the given time run
+func (s scheduledCall) due(now time.Duration) bool {
+	return s.at < now || (s.at == now && !s.afterLines)
+}
+
+// after returns true if the call is made after lines that start at the given time
+func (s scheduledCall) after(line time.Duration) bool {
+	return line < s.at || (line == s.at && s.afterLines)
+}
+
+// CallAt calls f once the simulated time reaches at, before any line that is due at this time runs.
+// Functions scheduled for the same time are called in the order they have been scheduled.
+// f is called by the goroutine driving the coordinator (see Run() and Tick()) while no line is executed.
+// While calls are pending, the vms are never considered idle (see EnableIdleDetection()).
+// MUST be called before Run() or Tick()
+func (c *Coordinator) CallAt(at time.Duration, f func()) {
+	c.schedule(scheduledCall{
+		at: at,
+		f:  f,
+	})
+}
+
+// CallAfter calls f after all lines that are due at the given time have run, before any later line runs.
+// This can be used to inspect the state at the end of a point in simulated time.
+// Otherwise it behaves like CallAt(). If the vms terminate at the given time, f is never called.
+// MUST be called before Run() or Tick()
+func (c *Coordinator) CallAfter(at time.Duration, f func()) {
+	c.schedule(scheduledCall{
+		at:         at,
+		afterLines: true,
+		f:          f,
+	})
+}
+
+// schedule adds the call to the scheduled calls. Calls are ordered by the point in time they are due
+func (c *Coordinator) schedule(call scheduledCall) {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	c.scheduledCalls = append(c.scheduledCalls, call)
+	sort.SliceStable(c.scheduledCalls, func(i, j int) bool {
+		a := c.scheduledCalls[i]
+		b := c.scheduledCalls[j]
+		return a.at < b.at || (a.at == b.at && !a.afterLines && b.afterLines)
+	})
+}
+
+// SetVariableAt sets the global variable (see SetVariable()) once the simulated time reaches at (see CallAt()).
+// This can be used to simulate user-input during a run.
+// MUST be called before Run() or Tick()
+func (c *Coordinator) SetVariableAt(at time.Duration, name string, value *Variable) {
+	c.CallAt(at, func() {
+		c.SetVariable(name, value)
+	})
+}
+
+// runScheduledCalls calls all scheduled functions that have to be called before the lines due at the current simulated time
+func (c *Coordinator) runScheduledCalls() {
+	c.vmLock.Lock()
+	due := 0
+	for due < len(c.scheduledCalls) && c.scheduledCalls[due].due(c.now) {
+		due++
+	}
+	calls := c.scheduledCalls[:due]
+	c.scheduledCalls = c.scheduledCalls[due:]
+	if due > 0 {
+		last := calls[due-1]
+		c.lastCall = &last
+	}
+	c.vmLock.Unlock()
+
+	for _, call := range calls {
+		call.f()
+	}
+}
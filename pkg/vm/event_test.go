@@ -0,0 +1,66 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestSetVariableAt(t *testing.T) {
+	coord := vm.NewCoordinator()
+	// counts the lines during which the button is pressed and stops once it has been released
+	v, _ := vm.CreateSyncFromSource("if :button then :pressed++ end\nif :pressed and not :button then :done = 1 end goto 1")
+	v.SetCoordinator(coord)
+	v.Resume()
+	coord.EnableIdleDetection()
+	coord.SetTimeLimit(time.Minute)
+	one, _ := vm.VariableFromType(1)
+	zero, _ := vm.VariableFromType(0)
+	// schedule out of order. The writes are applied by time
+	coord.SetVariableAt(10*time.Second, ":button", zero)
+	coord.SetVariableAt(6*time.Second, ":button", one)
+
+	for coord.Tick() {
+		if done, _ := coord.GetVariable(":done"); done != nil {
+			break
+		}
+	}
+
+	if done, _ := coord.GetVariable(":done"); done == nil {
+		t.Fatal("The chip must not be considered idle while writes are pending")
+	}
+	// the button is pressed for 4s (20 lines). Every second line counts
+	ten, _ := vm.VariableFromType(10)
+	if pressed, _ := coord.GetVariable(":pressed"); pressed == nil || !pressed.Equals(ten) {
+		t.Fatalf("The button should have been pressed for 10 iterations, but the result is: %v", pressed)
+	}
+	if now := coord.Now(); now < 10*time.Second || now > 11*time.Second {
+		t.Fatalf("The run should have ended right after the release of the button, but ended at %s", now)
+	}
+}
+
+func TestCallAfter(t *testing.T) {
+	coord := vm.NewCoordinator()
+	v, _ := vm.CreateSyncFromSource(":a++ goto 1")
+	v.SetCoordinator(coord)
+	v.Resume()
+	var before, after string
+	// scheduled in reverse order. Calls before the lines of a time always come first
+	coord.CallAfter(400*time.Millisecond, func() {
+		a, _ := coord.GetVariable(":a")
+		after = a.Repr()
+	})
+	coord.CallAt(400*time.Millisecond, func() {
+		a, _ := coord.GetVariable(":a")
+		before = a.Repr()
+	})
+	for coord.Now() < time.Second {
+		coord.Tick()
+	}
+	v.Terminate()
+
+	if before != "2" || after != "3" {
+		t.Fatalf("The line at 400ms must run between the calls, but :a was %s before and %s after it", before, after)
+	}
+}
@@ -0,0 +1,371 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VariableWrite describes a single write to a variable
+type VariableWrite struct {
+	// the normalized (lowercased) name of the variable
+	Name string
+	// the value before the write. nil if the variable did not exist before
+	Old *Variable
+	// the value after the write
+	New *Variable
+}
+
+// HistoryEntry contains everything that is needed to revert the execution of a single line
+type HistoryEntry struct {
+	// the vm that executed the line
+	VM *VM
+	// the executed line in the ast
+	AstLine int
+	// the source-line the executed line starts at
+	SourceLine int
+	// the number of lines the vm had executed before executing this line
+	ExecutedLines int
+	// all writes to variables performed by the line, in the order they happened
+	Writes []VariableWrite
+	// the line the execution jumped to using goto. 0 if the line did not jump
+	JumpTarget int
+	// the simulated time at which the line started. 0 for uncoordinated vms.
+	// This is also the time the coordinator had scheduled the line for. Reverting the line schedules it for this time again
+	Time time.Duration
+	// the runtime-error that aborted the line, if any
+	Err error
+}
+
+// History records the lines executed by one or more VMs in a ring-buffer, so the execution can be reversed.
+// When multiple coordinated VMs share one history, the order of the recorded lines matches the order of execution.
+type History struct {
+	lock    *sync.Mutex
+	entries []*HistoryEntry
+	// index where the next entry will be stored
+	next int
+	// number of valid entries in the buffer
+	count int
+	// all vms that record into this history
+	vms []*VM
+}
+
+// NewHistory returns a new history that remembers the last size executed lines
+func NewHistory(size int) *History {
+	if size < 1 {
+		size = 1
+	}
+	return &History{
+		lock:    &sync.Mutex{},
+		entries: make([]*HistoryEntry, size),
+		vms:     make([]*VM, 0),
+	}
+}
+
+// Len returns the number of lines that can currently be reverted
+func (h *History) Len() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.count
+}
+
+// Entries returns a copy of the recorded entries. The oldest entry is the first one.
+func (h *History) Entries() []HistoryEntry {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	li := make([]HistoryEntry, h.count)
+	for i := 0; i < h.count; i++ {
+		idx := (h.next - h.count + i + len(h.entries)) % len(h.entries)
+		li[i] = *h.entries[idx]
+	}
+	return li
+}
+
+// StepBack reverts the most recently executed line of any of the vms using this history.
+// For coordinated vms, the simulated time and the schedule of the coordinator are reverted too.
+// All VMs using this history MUST be paused (or be waiting for their coordinator).
+// Returns the vm whose line has been reverted, or nil if there is nothing left to revert.
+// Returns an error if the line can not be reverted, because the state of connected devices or the effects
+// of scheduled events (see Coordinator.CallAt()) would have to be reverted too.
+func (h *History) StepBack() (*VM, error) {
+	h.lock.Lock()
+	vms := make([]*VM, len(h.vms))
+	copy(vms, h.vms)
+	h.lock.Unlock()
+	for _, v := range vms {
+		if c := v.getCoordinator(); c != nil {
+			if err := c.canRevert(c.Now()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// a paused vm could be in the middle of a line that already changed variables. Revert this first
+	for _, v := range vms {
+		if v.revertCurrentLine() {
+			return v, nil
+		}
+	}
+
+	h.lock.Lock()
+	if h.count == 0 {
+		h.lock.Unlock()
+		return nil, nil
+	}
+	idx := (h.next - 1 + len(h.entries)) % len(h.entries)
+	entry := h.entries[idx]
+	h.lock.Unlock()
+
+	// there is no way to bring a terminated vm back to life
+	if entry.VM.State() == StateTerminated {
+		return nil, nil
+	}
+	coordinator := entry.VM.getCoordinator()
+	if coordinator != nil {
+		if err := coordinator.canRevert(entry.Time); err != nil {
+			return nil, err
+		}
+	}
+
+	h.lock.Lock()
+	h.entries[idx] = nil
+	h.next = idx
+	h.count--
+	h.lock.Unlock()
+
+	entry.VM.revertLine(entry)
+	if coordinator != nil {
+		coordinator.lineReverted(entry.VM, entry.Time)
+	}
+	return entry.VM, nil
+}
+
+// StepBackVM reverts lines until a line of the given vm has been reverted.
+// Lines of other vms that have been executed after the last line of v are also reverted.
+// Returns false if there was no line of v left to revert.
+func (h *History) StepBackVM(v *VM) (bool, error) {
+	for {
+		reverted, err := h.StepBack()
+		if reverted == nil || err != nil {
+			return false, err
+		}
+		if reverted == v {
+			return true, nil
+		}
+	}
+}
+
+// ReverseContinue reverts lines until a line with a breakpoint is reached or there is nothing left to revert.
+// Returns the vm that is paused at a breakpoint, or nil if the beginning of the history has been reached.
+func (h *History) ReverseContinue() (*VM, error) {
+	for {
+		reverted, err := h.StepBack()
+		if reverted == nil || err != nil {
+			return nil, err
+		}
+		if reverted.hasBreakpointAtCurrentLine() {
+			return reverted, nil
+		}
+	}
+}
+
+// register adds a vm to the list of vms using this history
+func (h *History) register(v *VM) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.vms = append(h.vms, v)
+}
+
+// add appends an entry to the history. If the buffer is full, the oldest entry is dropped
+func (h *History) add(e *HistoryEntry) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % len(h.entries)
+	if h.count < len(h.entries) {
+		h.count++
+	}
+}
+
+// SetHistory sets the history the vm records the executed lines to
+func (v *VM) SetHistory(h *History) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.history = h
+	h.register(v)
+}
+
+// beginHistoryEntry starts recording the line the vm is about to execute (for the history and/or the trace)
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) beginHistoryEntry(sourceLine int) {
+	if v.history == nil && v.trace == nil {
+		return
+	}
+	v.historyEntry = &HistoryEntry{
+		VM:            v,
+		AstLine:       v.currentAstLine,
+		SourceLine:    sourceLine,
+		ExecutedLines: v.executedLines,
+		Writes:        make([]VariableWrite, 0, 2),
+	}
+	if v.coordinator != nil {
+		v.historyEntry.Time = v.coordinator.Now()
+	}
+}
+
+// finishHistoryEntry adds the recorded entry for the current line to the history and the trace.
+// err is the error that aborted the line (if any)
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) finishHistoryEntry(err error) {
+	if v.historyEntry == nil {
+		return
+	}
+	v.historyEntry.Err = err
+	if v.history != nil {
+		v.history.add(v.historyEntry)
+	}
+	if v.trace != nil {
+		v.trace.add(v.historyEntry)
+	}
+	v.historyEntry = nil
+}
+
+// recordWrite records a write to a variable for the current history entry
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) recordWrite(name string, old *Variable, value *Variable) {
+	if v.historyEntry == nil {
+		return
+	}
+	v.historyEntry.Writes = append(v.historyEntry.Writes, VariableWrite{
+		Name: name,
+		Old:  old,
+		New:  value,
+	})
+}
+
+// revertLine reverts the changes done by the line recorded in e and moves the vm back to this line
+func (v *VM) revertLine(e *HistoryEntry) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.revertWrites(e.Writes)
+	v.executedLines = e.ExecutedLines
+	// if the vm is paused right after the reverted line, this line must not count as executed
+	v.lineFinished = false
+	v.relocatedAfterLine = false
+	v.relocate(e.AstLine, e.SourceLine)
+}
+
+// revertCurrentLine reverts the partially executed current line, if the vm is paused in the middle of a line
+// Returns true if there was something to revert
+func (v *VM) revertCurrentLine() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	e := v.historyEntry
+	if e == nil || !v.runningLine || (len(e.Writes) == 0 && v.currentSourceLine == e.SourceLine) {
+		return false
+	}
+	v.revertWrites(e.Writes)
+	v.relocate(e.AstLine, e.SourceLine)
+	return true
+}
+
+// revertWrites undoes the given writes in reverse order
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) revertWrites(writes []VariableWrite) {
+	for i := len(writes) - 1; i >= 0; i-- {
+		w := writes[i]
+		if v.coordinator != nil && strings.HasPrefix(w.Name, ":") {
+			v.coordinator.setGlobal(v, w.Name, w.Old)
+		}
+		v.storeLocal(w.Name, w.Old)
+	}
+}
+
+// hasBreakpointAtCurrentLine returns true if there is a breakpoint (but not a logpoint) at the current source-line
+// Conditions and hit-counts are ignored when executing backwards
+func (v *VM) hasBreakpointAtCurrentLine() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	bp, exists := v.breakpoints[v.currentSourceLine]
+	return exists && !bp.IsLogpoint()
+}
+
+// getCoordinator returns the coordinator of the vm, or nil if the vm is not coordinated
+func (v *VM) getCoordinator() *Coordinator {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.coordinator
+}
+
+// yieldLine aborts the line the vm is paused in and makes the vm give back its permission to run a line,
+// so the coordinator chooses again which vm runs next
+func (v *VM) yieldLine() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if !v.runningLine || v.lineFinished || v.currentAstLine-1 >= len(v.program.Lines) {
+		return
+	}
+	line := v.program.Lines[v.currentAstLine-1]
+	start := line.Start()
+	if len(line.Statements) > 0 {
+		start = line.Statements[0].Start()
+	}
+	v.relocate(v.currentAstLine, start.Line)
+	v.yielded = true
+}
+
+// canRevert returns an error if lines that started at the given simulated time can not be reverted
+func (c *Coordinator) canRevert(at time.Duration) error {
+	c.varLock.Lock()
+	hasDevices := len(c.devices) > 0
+	c.varLock.Unlock()
+	if hasDevices {
+		return fmt.Errorf("Can not step back while devices are connected. The state of the devices can not be reverted")
+	}
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	if c.lastCall != nil && c.lastCall.after(at) {
+		return fmt.Errorf("Can not step back before the event at %s. The effects of events can not be reverted", c.lastCall.at)
+	}
+	return nil
+}
+
+// lineReverted schedules the reverted line of v (that started at the given time) again
+// and moves the simulated time back to the start of the line
+func (c *Coordinator) lineReverted(v *VM, at time.Duration) {
+	c.vmLock.Lock()
+	idx := -1
+	holderIdx := -1
+	for i, other := range c.vms {
+		if other == v {
+			idx = i
+		}
+		if other == c.holder {
+			holderIdx = i
+		}
+	}
+	if idx < 0 {
+		c.vmLock.Unlock()
+		return
+	}
+	c.nextLineTimes[idx] = at
+	c.now = at
+	// the vm holding the permission to run a line may now be due after the reverted line
+	var yield *VM
+	if holderIdx >= 0 && holderIdx != idx {
+		holderAt := c.nextLineTimes[holderIdx]
+		if holderAt > at || (holderAt == at && holderIdx > idx) {
+			yield = c.holder
+		}
+	}
+	c.vmLock.Unlock()
+
+	if yield != nil {
+		yield.yieldLine()
+	}
+	select {
+	case c.rescheduled <- struct{}{}:
+	default:
+	}
+}
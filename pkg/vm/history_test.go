@@ -0,0 +1,214 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestStepBackCoordinated(t *testing.T) {
+	prog1 := `:result = ""
+:result += "b"
+:result += "d"
+:result += "f"
+:result += "h"
+`
+	prog2 := `:result += "a"
+:result += "c"
+:result += "e"
+:result += "g"
+`
+	coord := vm.NewCoordinator()
+	history := vm.NewHistory(100)
+	vm1, _ := vm.CreateFromSource(prog1)
+	vm2, _ := vm.CreateFromSource(prog2)
+
+	for _, v := range []*vm.VM{vm1, vm2} {
+		v.SetCoordinator(coord)
+		v.SetHistory(history)
+		v.SetMaxExecutedLines(10)
+	}
+
+	hit := make(chan struct{})
+	vm1.SetBreakpointHandler(func(v *vm.VM) bool {
+		hit <- struct{}{}
+		return false
+	})
+	vm1.AddBreakpoint(4)
+
+	vm1.Resume()
+	vm2.Resume()
+	coord.Run()
+	<-hit
+
+	result, _ := coord.GetVariable(":result")
+	if result.String() != "abcde" {
+		t.Fatalf("Wrong result at breakpoint. Wanted 'abcde' but got '%s'", result.String())
+	}
+
+	if reverted, err := history.StepBackVM(vm1); !reverted || err != nil {
+		t.Fatal("Stepping back failed", err)
+	}
+	if now := coord.Now(); now != 400*time.Millisecond {
+		t.Fatalf("Stepping back should have reverted the simulated time to 400ms, but it is %s", now)
+	}
+
+	result, _ = coord.GetVariable(":result")
+	if result.String() != "abc" {
+		t.Fatalf("Wrong result after stepping back. Wanted 'abc' but got '%s'", result.String())
+	}
+	if vm1.CurrentAstLine() != 3 || vm2.CurrentAstLine() != 3 {
+		t.Fatalf("Wrong lines after stepping back: %d, %d", vm1.CurrentAstLine(), vm2.CurrentAstLine())
+	}
+
+	vm1.RemoveBreakpoint(4)
+	vm1.Resume()
+	coord.WaitForTermination()
+
+	result, _ = coord.GetVariable(":result")
+	if result.String() != "abcdefgh" {
+		t.Fatalf("Wrong result for computation, wanted %s but got %s", "abcdefgh", result.String())
+	}
+}
+
+func TestStepBackReschedules(t *testing.T) {
+	prog1 := `:result = "a"
+:result += "c"
+:result += "e"
+:result += "g"
+`
+	prog2 := `:result += "b"
+:result += "d"
+:result += "f"
+:result += "h"
+`
+	coord := vm.NewCoordinator()
+	history := vm.NewHistory(100)
+	vm1, _ := vm.CreateFromSource(prog1)
+	vm2, _ := vm.CreateFromSource(prog2)
+
+	for _, v := range []*vm.VM{vm1, vm2} {
+		v.SetCoordinator(coord)
+		v.SetHistory(history)
+		v.SetMaxExecutedLines(4)
+	}
+
+	hit := make(chan struct{})
+	vm1.SetBreakpointHandler(func(v *vm.VM) bool {
+		hit <- struct{}{}
+		return false
+	})
+	vm1.AddBreakpoint(4)
+
+	vm1.Resume()
+	vm2.Resume()
+	coord.Run()
+	<-hit
+
+	// vm1 waits at line 4 (600ms). Reverting the third line of vm2 (400ms) must make it run before line 4 of vm1
+	if reverted, err := history.StepBackVM(vm2); !reverted || err != nil {
+		t.Fatal("Stepping back failed", err)
+	}
+	result, _ := coord.GetVariable(":result")
+	if result.String() != "abcde" {
+		t.Fatalf("Wrong result after stepping back. Wanted 'abcde' but got '%s'", result.String())
+	}
+
+	vm1.RemoveBreakpoint(4)
+	vm1.Resume()
+	coord.WaitForTermination()
+
+	result, _ = coord.GetVariable(":result")
+	if result.String() != "abcdefgh" {
+		t.Fatalf("Wrong result for computation, wanted %s but got %s", "abcdefgh", result.String())
+	}
+}
+
+func TestStepBackRefused(t *testing.T) {
+	coord := vm.NewCoordinator()
+	history := vm.NewHistory(100)
+	v, _ := vm.CreateSyncFromSource(":a++ goto 1")
+	v.SetCoordinator(coord)
+	v.SetHistory(history)
+	v.Resume()
+	one, _ := vm.VariableFromType(1)
+	coord.SetVariableAt(time.Second, ":event", one)
+	for coord.Now() < 2*time.Second {
+		coord.Tick()
+	}
+
+	// the lines since the event can be reverted
+	for coord.Now() > time.Second {
+		if _, err := history.StepBack(); err != nil {
+			t.Fatal("Stepping back after the event failed:", err)
+		}
+	}
+	if _, err := history.StepBack(); err == nil {
+		t.Fatal("Stepping back before the event must fail")
+	}
+	if event, _ := coord.GetVariable(":event"); event == nil {
+		t.Fatal("The effects of the event must not be reverted")
+	}
+
+	coord = vm.NewCoordinator()
+	history = vm.NewHistory(100)
+	v, _ = vm.CreateSyncFromSource(":copy = :steps")
+	v.SetCoordinator(coord)
+	v.SetHistory(history)
+	coord.AddDevice(&testDevice{})
+	v.Resume()
+	coord.Tick()
+	coord.Tick()
+	if _, err := history.StepBack(); err == nil {
+		t.Fatal("Stepping back while devices are connected must fail")
+	}
+}
+
+func TestReverseContinue(t *testing.T) {
+	prog := `a = 0
+a++
+b = a * 2
+if a < 10 then goto 2 end
+:done = 1
+`
+	history := vm.NewHistory(5)
+	v, _ := vm.CreateFromSource(prog)
+	v.SetHistory(history)
+	finished := make(chan struct{})
+	v.SetLineExecutedHandler(func(v *vm.VM) bool {
+		done, _ := v.GetVariable(":done")
+		if done != nil {
+			finished <- struct{}{}
+			return false
+		}
+		return true
+	})
+	v.Resume()
+	<-finished
+
+	if history.Len() != 5 {
+		t.Fatalf("History should be limited to 5 entries but has %d", history.Len())
+	}
+
+	v.AddBreakpoint(3)
+	if stoppedAt, _ := history.ReverseContinue(); stoppedAt != v {
+		t.Fatal("Reverse continue did not stop at a breakpoint")
+	}
+
+	a, _ := v.GetVariable("a")
+	b, _ := v.GetVariable("b")
+	if a.Number().Int() != 10 || b.Number().Int() != 18 {
+		t.Fatalf("Wrong variables after reverse continue. a=%s, b=%s", a.Repr(), b.Repr())
+	}
+	if _, exists := v.GetVariable(":done"); exists {
+		t.Fatal(":done should have been reverted")
+	}
+
+	history.StepBack()
+	history.StepBack()
+	if reverted, _ := history.StepBack(); reverted != nil {
+		t.Fatal("History should be exhausted")
+	}
+	v.Terminate()
+}
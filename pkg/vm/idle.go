@@ -0,0 +1,194 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IdleError describes a run in which all coordinated vms have become idle:
+// they do not change any variable anymore and repeat the same lines over and over again.
+type IdleError struct {
+	// the tick since which the vms are idle. The first lines run at tick 1 and a tick lasts as long as
+	// one line of a vm running at DefaultLinesPerSecond
+	Tick int
+	// the simulated time since which the vms are idle
+	Time time.Duration
+}
+
+func (e IdleError) Error() string {
+	return fmt.Sprintf("All chips idle since tick %d (%s): no variable changes anymore and the chips are stuck in a loop", e.Tick, e.Time)
+}
+
+// IdleHandlerFunc is called when all coordinated vms have become idle.
+// If it returns false, all vms are terminated. Otherwise the execution continues
+// and the handler is not called again until a variable changes and the vms become idle again.
+type IdleHandlerFunc func(err IdleError) bool
+
+// idleDetector keeps track of the states the coordinated vms have been in since the last change of a variable
+type idleDetector struct {
+	// the vms that have executed a line in the current round
+	ran map[*VM]bool
+	// the variables at the end of the last round
+	lastVars string
+	// the simulated time of the last change of a variable
+	changedTime time.Duration
+	// all states (positions of the vms) seen since the last change of a variable
+	seen map[string]bool
+	// true if the current idle-phase has already been reported
+	reported bool
+	handler  IdleHandlerFunc
+	result   *IdleError
+}
+
+// EnableIdleDetection makes the coordinator detect when all vms have become idle: a full round over all vms
+// changes no variable and all vms are at a position (line and timing) they have already been at since
+// the last change of a variable. As the vms are deterministic, they would repeat the same lines forever.
+// Once this is detected, the idle-handler (see SetIdleHandler()) is called. Without handler, all vms are terminated.
+// Devices are assumed to have no state except their fields, unless they are active (see ActiveDevice).
+// MUST be called before Run() or Tick()
+func (c *Coordinator) EnableIdleDetection() {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	if c.idle == nil {
+		c.idle = &idleDetector{
+			ran:  make(map[*VM]bool),
+			seen: make(map[string]bool),
+		}
+	}
+}
+
+// SetIdleHandler sets the function that is called when all vms have become idle. Enables idle-detection.
+// MUST be called before Run() or Tick()
+func (c *Coordinator) SetIdleHandler(f IdleHandlerFunc) {
+	c.EnableIdleDetection()
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	c.idle.handler = f
+}
+
+// Idle returns the result of the idle-detection: nil if the vms have never become idle (or detection is disabled)
+func (c *Coordinator) Idle() *IdleError {
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	if c.idle == nil || c.idle.result == nil {
+		return nil
+	}
+	result := *c.idle.result
+	return &result
+}
+
+// idleState returns the local variables of the vm and the line after which the vm continues execution
+func (v *VM) idleState() (string, int) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return formatVariables(v.variables, true), v.finishedAstLine
+}
+
+// formatVariables returns a canonical string-representation of the given variables.
+// If localsOnly is true, global variables are skipped
+func formatVariables(vars map[string]*Variable, localsOnly bool) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		if localsOnly && strings.HasPrefix(name, ":") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sb := &strings.Builder{}
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteString("=")
+		sb.WriteString(vars[name].Repr())
+		sb.WriteString(";")
+	}
+	return sb.String()
+}
+
+// checkIdle is called after v executed a line. It returns true if all vms are idle and should be terminated
+func (c *Coordinator) checkIdle(v *VM) bool {
+	c.vmLock.Lock()
+	if c.idle == nil {
+		c.vmLock.Unlock()
+		return false
+	}
+	c.idle.ran[v] = true
+	c.vmLock.Unlock()
+
+	// the round is complete once every running vm has executed a line
+	vms := c.registeredVMs()
+	for _, other := range vms {
+		if other.State() == StateTerminated {
+			continue
+		}
+		c.vmLock.Lock()
+		ran := c.idle.ran[other]
+		c.vmLock.Unlock()
+		if !ran {
+			return false
+		}
+	}
+
+	vars := &strings.Builder{}
+	c.varLock.Lock()
+	networks := make([]string, 0, len(c.networks))
+	for network := range c.networks {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	for _, network := range networks {
+		vars.WriteString(network)
+		vars.WriteString("{")
+		vars.WriteString(formatVariables(c.networks[network], false))
+		vars.WriteString("}")
+	}
+	c.varLock.Unlock()
+	// an active device changes its (internal) state, even if its fields do not change visibly
+	active := c.devicesActive()
+	positions := make([]int, len(vms))
+	for i, other := range vms {
+		locals, line := other.idleState()
+		vars.WriteString(locals)
+		vars.WriteString("|")
+		positions[i] = line
+	}
+
+	c.vmLock.Lock()
+	d := c.idle
+	d.ran = make(map[*VM]bool)
+	if vars.String() != d.lastVars || active {
+		d.lastVars = vars.String()
+		d.changedTime = c.now
+		d.seen = make(map[string]bool)
+		d.reported = false
+	}
+	state := &strings.Builder{}
+	for i := range positions {
+		if i >= len(c.nextLineTimes) {
+			break
+		}
+		// the timing of the vms relative to each other is part of the state
+		fmt.Fprintf(state, "%d@%d;", positions[i], c.nextLineTimes[i]-c.now)
+	}
+	// a pending call (like a scheduled write) may wake up the vms
+	if !d.seen[state.String()] || d.reported || len(c.scheduledCalls) > 0 {
+		d.seen[state.String()] = true
+		c.vmLock.Unlock()
+		return false
+	}
+	d.reported = true
+	d.result = &IdleError{
+		Tick: tickAt(d.changedTime),
+		Time: d.changedTime,
+	}
+	result := *d.result
+	handler := d.handler
+	c.vmLock.Unlock()
+
+	if handler != nil {
+		return !handler(result)
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestIdleDetection(t *testing.T) {
+	coord := vm.NewCoordinator()
+	// the waiter waits for :go, which is never set. The counter stops counting after 3 lines
+	for _, prog := range []string{"a = 1\nif :go == 0 then goto 2 end\n:done = 1", "if :count < 3 then :count++ end goto 1"} {
+		v, _ := vm.CreateSyncFromSource(prog)
+		v.SetCoordinator(coord)
+		v.Resume()
+	}
+	coord.EnableIdleDetection()
+	coord.SetTimeLimit(time.Minute)
+	ticks := 0
+	for coord.Tick() {
+		ticks++
+	}
+
+	idle := coord.Idle()
+	if idle == nil {
+		t.Fatal("The idle chips have not been detected")
+	}
+	if idle.Tick != 3 || idle.Time != 400*time.Millisecond {
+		t.Fatalf("Wrong start of the idle-phase: %+v", idle)
+	}
+	if ticks > 5 {
+		t.Fatalf("The run should have ended early, but ran for %d ticks", ticks)
+	}
+	if done, _ := coord.GetVariable(":done"); done != nil {
+		t.Fatal("The waiting chip must not have continued")
+	}
+}
+
+func TestIdleHandler(t *testing.T) {
+	coord := vm.NewCoordinator()
+	v, _ := vm.CreateSyncFromSource("if :go == 0 then goto 1 end\n:done = 1 goto 2")
+	v.SetCoordinator(coord)
+	v.Resume()
+	calls := 0
+	coord.SetIdleHandler(func(err vm.IdleError) bool {
+		calls++
+		// wake up the chip and continue
+		coord.SetVariable(":go", &vm.Variable{Value: "yes"})
+		return true
+	})
+	coord.SetTimeLimit(2 * time.Second)
+	for coord.Tick() {
+	}
+	if calls != 2 {
+		t.Fatalf("The handler should have been called twice (for both idle-phases), but was called %d times", calls)
+	}
+	if done, _ := coord.GetVariable(":done"); done == nil {
+		t.Fatal("The chip should have continued after being woken up")
+	}
+
+	counter := vm.NewCoordinator()
+	v, _ = vm.CreateSyncFromSource("a++ goto 1")
+	v.SetCoordinator(counter)
+	v.Resume()
+	counter.EnableIdleDetection()
+	counter.SetTimeLimit(10 * time.Second)
+	for counter.Tick() {
+	}
+	if counter.Idle() != nil {
+		t.Fatal("A counting chip is not idle")
+	}
+}
@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// JumpTargets returns the source-lines the execution can be moved to using JumpToLine.
+// These are the source-lines at which a line of the program starts.
+func (v *VM) JumpTargets() []int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	targets := make([]int, 0, len(v.program.Lines))
+	for sourceLine := range v.jumpTargets() {
+		targets = append(targets, sourceLine)
+	}
+	sort.Ints(targets)
+	return targets
+}
+
+// JumpToLine moves the execution of a paused vm to the given source-line. When resumed, the vm continues
+// execution at the beginning of this line. If the vm is paused in the middle of a line, the rest of that line is skipped.
+// Variables are not changed. Returns an error if the vm has terminated or the line is not a valid target (see JumpTargets)
+func (v *VM) JumpToLine(sourceLine int) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.state == StateTerminated {
+		return fmt.Errorf("The vm has already terminated")
+	}
+	astLine, exists := v.jumpTargets()[sourceLine]
+	if !exists {
+		return fmt.Errorf("Can not jump to line %d. Execution can only be moved to the beginning of a line", sourceLine)
+	}
+	v.relocate(astLine, sourceLine)
+	return nil
+}
+
+// jumpTargets returns a mapping from valid jump-targets (source-lines) to the matching ast-lines
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) jumpTargets() map[int]int {
+	targets := make(map[int]int, len(v.program.Lines))
+	for i, line := range v.program.Lines {
+		start := line.Start()
+		if len(line.Statements) > 0 {
+			start = line.Statements[0].Start()
+		}
+		// lines from included files can not be targeted
+		if start.File != "" {
+			continue
+		}
+		if _, exists := targets[start.Line]; !exists {
+			targets[start.Line] = i + 1
+		}
+	}
+	return targets
+}
@@ -0,0 +1,97 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestJumpToLine(t *testing.T) {
+	prog := `a = 1
+a *= 2
+a += 1
+:done = 1
+`
+	v, _ := vm.CreateFromSource(prog)
+	v.SetLineExecutedHandler(vm.TerminateOnDoneVar)
+	hit := make(chan struct{})
+	v.SetBreakpointHandler(func(x *vm.VM) bool {
+		hit <- struct{}{}
+		return false
+	})
+	v.AddBreakpoint(3)
+	v.Resume()
+	<-hit
+
+	if err := v.JumpToLine(7); err == nil {
+		t.Fatal("Jumping to a line without code should fail")
+	}
+
+	// run line 2 again
+	err := v.JumpToLine(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.CurrentSourceLine() != 2 {
+		t.Fatalf("Vm should be at line 2, but is at %d", v.CurrentSourceLine())
+	}
+	v.RemoveBreakpoint(3)
+	v.Resume()
+	v.WaitForTermination()
+
+	a, _ := v.GetVariable("a")
+	if a.Itoa() != "5" {
+		t.Fatalf("Wrong value for a. Wanted 5 but got %s", a.Itoa())
+	}
+
+	if err := v.JumpToLine(1); err == nil {
+		t.Fatal("Jumping in a terminated vm should fail")
+	}
+}
+
+func TestJumpAfterLine(t *testing.T) {
+	coord := vm.NewCoordinator()
+	a, _ := vm.CreateFromSource(":a++\n:a++\n:a++\n:a++")
+	b, _ := vm.CreateFromSource(":b++")
+	a.SetCoordinator(coord)
+	b.SetCoordinator(coord)
+	coord.SetTimeLimit(2 * time.Second)
+
+	paused := make(chan struct{})
+	lines := make([]int, 0)
+	a.SetLineExecutedHandler(func(x *vm.VM) bool {
+		lines = append(lines, x.CurrentSourceLine())
+		// pause after the first line, like a breakpoint would
+		if len(lines) == 1 {
+			close(paused)
+			return false
+		}
+		return true
+	})
+	a.Resume()
+	b.Resume()
+	coord.Run()
+	<-paused
+
+	// the first line has been completed and must still count as executed
+	err := a.JumpToLine(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Resume()
+	coord.WaitForTermination()
+
+	if len(lines) < 3 || lines[1] != 3 || lines[2] != 4 {
+		t.Fatalf("Execution should have continued at line 3, but executed lines %v", lines)
+	}
+	// 10 lines of code (1,3,4,1,2,3,4,1,2,3) and twice the 16 empty lines after line 4
+	if a.GetExecutedLines() != 42 {
+		t.Fatalf("Wrong number of executed lines. Wanted 42 but got %d", a.GetExecutedLines())
+	}
+	for _, name := range []string{":a", ":b"} {
+		if value, _ := coord.GetVariable(name); value.Itoa() != "10" {
+			t.Fatalf("Wrong value for %s. Wanted 10 but got %s", name, value.Itoa())
+		}
+	}
+}
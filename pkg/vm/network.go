@@ -0,0 +1,216 @@
+package vm
+
+import (
+	"strings"
+)
+
+// DefaultNetwork is the data-network vms and devices are connected to, unless configured otherwise.
+// Global variables of the default network are addressed by their plain name (e.g. ":fuel").
+// Variables of other networks are addressed by prefixing the name with the name of the network (e.g. "engine:fuel").
+// Vms only see the globals of the networks they are connected to, so scripts can not accidentally depend on
+// fields of other networks. Use bridges to forward fields between networks.
+const DefaultNetwork = "default"
+
+// Bridge forwards writes to the selected fields from one data-network to another (like a relay in starbase)
+type Bridge struct {
+	// The network to forward from
+	From string
+	// The network to forward to
+	To string
+	// The names of the forwarded fields. An empty list forwards all fields
+	Fields []string
+	// If true, the fields are also forwarded from To to From
+	Bidirectional bool
+}
+
+// forwards returns true if the bridge forwards the given (normalized) variable
+func (b Bridge) forwards(name string) bool {
+	if len(b.Fields) == 0 {
+		return true
+	}
+	for _, field := range b.Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeNetwork returns the normalized name of the network. An empty name refers to the default network
+func normalizeNetwork(network string) string {
+	if network == "" {
+		return DefaultNetwork
+	}
+	return strings.ToLower(network)
+}
+
+// QualifiedName returns the name used by the coordinator for the global variable on the given network
+func QualifiedName(network string, name string) string {
+	network = normalizeNetwork(network)
+	name = strings.ToLower(name)
+	if !strings.HasPrefix(name, ":") {
+		name = ":" + name
+	}
+	if network == DefaultNetwork {
+		return name
+	}
+	return network + name
+}
+
+// SplitQualifiedName splits a name created by QualifiedName() into the name of the network and the name of the variable
+func SplitQualifiedName(qualified string) (network string, name string) {
+	qualified = strings.ToLower(qualified)
+	idx := strings.Index(qualified, ":")
+	if idx <= 0 {
+		return DefaultNetwork, qualified
+	}
+	return qualified[:idx], qualified[idx:]
+}
+
+// SetNetworks connects the given vm to the given networks (instead of the default network).
+// If a global variable exists on multiple of these networks, reads return the value from the network listed first
+// and writes go to all of these networks. Writes to variables that exist on none of the networks go to the first one.
+func (c *Coordinator) SetNetworks(v *VM, networks ...string) {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	if len(networks) == 0 {
+		delete(c.vmNetworks, v)
+		return
+	}
+	normalized := make([]string, len(networks))
+	for i, network := range networks {
+		normalized[i] = normalizeNetwork(network)
+	}
+	c.vmNetworks[v] = normalized
+}
+
+// Networks returns the names of the networks the given vm is connected to
+func (c *Coordinator) Networks(v *VM) []string {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	networks := c.networksOf(v)
+	copied := make([]string, len(networks))
+	copy(copied, networks)
+	return copied
+}
+
+// AddBridge adds a bridge that forwards writes between two networks.
+// Bridges MUST be added before calling Run() or Tick()
+func (c *Coordinator) AddBridge(b Bridge) {
+	b.From = normalizeNetwork(b.From)
+	b.To = normalizeNetwork(b.To)
+	fields := make([]string, len(b.Fields))
+	for i, field := range b.Fields {
+		fields[i] = QualifiedName(DefaultNetwork, field)
+	}
+	b.Fields = fields
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	c.bridges = append(c.bridges, b)
+}
+
+// networksOf returns the networks the given vm is connected to
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (c *Coordinator) networksOf(v *VM) []string {
+	if networks, exists := c.vmNetworks[v]; exists {
+		return networks
+	}
+	return []string{DefaultNetwork}
+}
+
+// store stores the value of the variable on the given network and forwards it over the bridges.
+// A value of nil deletes the variable. written contains the networks the variable has already been written to
+// and is updated with all networks written by this call.
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (c *Coordinator) store(network string, name string, value *Variable, written map[string]bool) {
+	if written[network] {
+		return
+	}
+	written[network] = true
+	vars, exists := c.networks[network]
+	if !exists {
+		vars = make(map[string]*Variable)
+		c.networks[network] = vars
+	}
+	if value == nil {
+		delete(vars, name)
+	} else {
+		vars[name] = value
+	}
+	for _, b := range c.bridges {
+		if !b.forwards(name) {
+			continue
+		}
+		if b.From == network {
+			c.store(b.To, name, value, written)
+		}
+		if b.Bidirectional && b.To == network {
+			c.store(b.From, name, value, written)
+		}
+	}
+}
+
+// getGlobal returns the value of the global variable as seen by the given vm
+func (c *Coordinator) getGlobal(v *VM, name string) (*Variable, bool) {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	name = c.resolveAlias(v, name)
+	for _, network := range c.networksOf(v) {
+		if val, exists := c.networks[network][name]; exists {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// setGlobal writes the global variable for the given vm. A value of nil deletes the variable
+func (c *Coordinator) setGlobal(v *VM, name string, value *Variable) {
+	c.varLock.Lock()
+	name = c.resolveAlias(v, name)
+	networks := c.networksOf(v)
+	targets := make([]string, 0, len(networks))
+	for _, network := range networks {
+		if _, exists := c.networks[network][name]; exists {
+			targets = append(targets, network)
+		}
+	}
+	if len(targets) == 0 {
+		targets = networks[:1]
+	}
+	written := make(map[string]bool)
+	for _, network := range targets {
+		c.store(network, name, value, written)
+	}
+	c.varLock.Unlock()
+	c.notifyDevices(name, value, written, "")
+}
+
+// visibleGlobals returns the global variables visible to the given vm
+func (c *Coordinator) visibleGlobals(v *VM) map[string]Variable {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	varlist := make(map[string]Variable)
+	networks := c.networksOf(v)
+	// iterate backwards, so the values from the first networks take precedence
+	for i := len(networks) - 1; i >= 0; i-- {
+		for key, value := range c.networks[networks[i]] {
+			varlist[key] = Variable{
+				Value: value.Value,
+			}
+		}
+	}
+	return varlist
+}
+
+// isWatchedBy returns true if there is a watchpoint for the given variable on one of the networks of the vm
+func (c *Coordinator) isWatchedBy(v *VM, name string) bool {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	name = c.resolveAlias(v, name)
+	for _, network := range c.networksOf(v) {
+		if c.watchpoints[QualifiedName(network, name)] {
+			return true
+		}
+	}
+	return false
+}
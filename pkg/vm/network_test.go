@@ -0,0 +1,51 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestNetworks(t *testing.T) {
+	coord := vm.NewCoordinator()
+	engine, _ := vm.CreateSyncFromSource(`:fuel = 10 :secret = 1 :seen = :target`)
+	cockpit, _ := vm.CreateSyncFromSource(`:target = 5 :copy = :fuel :leak = :secret`)
+	relay, _ := vm.CreateSyncFromSource(`:both = :fuel + :target`)
+	for _, v := range []*vm.VM{engine, cockpit, relay} {
+		v.SetCoordinator(coord)
+		v.Resume()
+	}
+	coord.SetNetworks(engine, "engine")
+	coord.SetNetworks(cockpit, "cockpit")
+	coord.SetNetworks(relay, "cockpit", "engine")
+	coord.AddBridge(vm.Bridge{
+		From:   "engine",
+		To:     "cockpit",
+		Fields: []string{"fuel"},
+	})
+
+	for i := 0; i < 2; i++ {
+		coord.Tick()
+	}
+
+	expect := map[string]string{
+		"engine:fuel":   "10",
+		"cockpit:fuel":  "10",
+		"cockpit:copy":  "10",
+		"engine:seen":   "0",
+		"cockpit:both":  "15",
+		"cockpit:leak":  "0",
+		"engine:secret": "1",
+	}
+	for name, want := range expect {
+		got, exists := coord.GetVariable(name)
+		if !exists || got.Itoa() != want {
+			t.Fatalf("Variable %s should be %s but is %v", name, want, got)
+		}
+	}
+	for _, name := range []string{":fuel", "engine:target", "engine:copy"} {
+		if _, exists := coord.GetVariable(name); exists {
+			t.Fatalf("Variable %s must not exist", name)
+		}
+	}
+}
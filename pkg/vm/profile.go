@@ -0,0 +1,314 @@
+package vm
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// ProfileEntry contains the number of executions of a single line or statement
+type ProfileEntry struct {
+	// the name of the script (see VM.SetProfile())
+	Script string
+	// the position of the line or statement. For lines, Coloumn is 0
+	Position ast.Position
+	// how often the line or statement has been executed
+	Executions int
+}
+
+// LoopProfile describes a goto-loop: a jump from one line to a previous line (or the same line)
+type LoopProfile struct {
+	// the name of the script (see VM.SetProfile())
+	Script string
+	// the line containing the goto
+	From int
+	// the target of the goto
+	To int
+	// how often the goto has been taken
+	Taken int
+	// the number of completed iterations. An iteration is the execution between two consecutive jumps
+	Iterations int
+	// the number of lines executed during all completed iterations
+	IterationLines int
+	// the simulated time spent in all completed iterations. 0 for uncoordinated vms
+	IterationTime time.Duration
+}
+
+// AverageLines returns the average number of lines executed per iteration
+func (l LoopProfile) AverageLines() float64 {
+	if l.Iterations == 0 {
+		return 0
+	}
+	return float64(l.IterationLines) / float64(l.Iterations)
+}
+
+// AverageTime returns the average simulated time per iteration
+func (l LoopProfile) AverageTime() time.Duration {
+	if l.Iterations == 0 {
+		return 0
+	}
+	return l.IterationTime / time.Duration(l.Iterations)
+}
+
+// BranchProfile counts the outcomes of the condition of an if-statement
+type BranchProfile struct {
+	// the name of the script (see VM.SetProfile())
+	Script string
+	// the position of the if-statement
+	Position ast.Position
+	// how often the condition has been true (the if-block has been executed)
+	Taken int
+	// how often the condition has been false (the else-block (if any) has been executed)
+	Skipped int
+}
+
+// jump identifies a goto by its source and target line
+type jump struct {
+	from int
+	to   int
+}
+
+// jumpMark remembers when a jump has been taken the last time
+type jumpMark struct {
+	executedLines int
+	time          time.Duration
+}
+
+// profileKey identifies a line or statement of a script
+type profileKey struct {
+	script   string
+	position ast.Position
+}
+
+// Profile counts how often the lines and statements of one or more VMs are executed.
+// Lines are counted by their position in the yolol-code (the ast-line) and by their position in the source-code.
+// For nolol-scripts, the source-positions refer to the original nolol-code.
+type Profile struct {
+	lock        *sync.Mutex
+	scripts     map[*VM]string
+	lines       map[profileKey]int
+	sourceLines map[profileKey]int
+	statements  map[profileKey]int
+	branches    map[profileKey]*BranchProfile
+	loops       map[string]map[jump]*LoopProfile
+	lastJumps   map[*VM]map[jump]jumpMark
+	// the source-lines touched by the line each vm currently executes
+	touched    map[*VM]map[ast.Position]bool
+	totalLines int
+}
+
+// NewProfile returns a new, empty profile
+func NewProfile() *Profile {
+	return &Profile{
+		lock:        &sync.Mutex{},
+		scripts:     make(map[*VM]string),
+		lines:       make(map[profileKey]int),
+		sourceLines: make(map[profileKey]int),
+		statements:  make(map[profileKey]int),
+		branches:    make(map[profileKey]*BranchProfile),
+		loops:       make(map[string]map[jump]*LoopProfile),
+		lastJumps:   make(map[*VM]map[jump]jumpMark),
+		touched:     make(map[*VM]map[ast.Position]bool),
+	}
+}
+
+// SetProfile makes the vm count its executed lines and statements in the given profile.
+// script is the name used for the vm in the profile. Multiple vms running the same script can use the same name
+func (v *VM) SetProfile(p *Profile, script string) {
+	p.lock.Lock()
+	p.scripts[v] = script
+	p.lastJumps[v] = make(map[jump]jumpMark)
+	p.lock.Unlock()
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.profile = p
+}
+
+// TotalLines returns the total number of executed lines
+func (p *Profile) TotalLines() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.totalLines
+}
+
+// Lines returns the number of executions per ast-line, the most executed line first
+func (p *Profile) Lines() []ProfileEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return sortedProfileEntries(p.lines)
+}
+
+// SourceLines returns the number of executions per source-line, the most executed line first.
+// A source-line counts as executed if at least one of its statements has been executed
+func (p *Profile) SourceLines() []ProfileEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return sortedProfileEntries(p.sourceLines)
+}
+
+// Statements returns the number of executions per statement, the most executed statement first
+func (p *Profile) Statements() []ProfileEntry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return sortedProfileEntries(p.statements)
+}
+
+// Branches returns the outcomes of all evaluated if-statements, ordered by script and position
+func (p *Profile) Branches() []BranchProfile {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	branches := make([]BranchProfile, 0, len(p.branches))
+	for _, branch := range p.branches {
+		branches = append(branches, *branch)
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		a, b := branches[i], branches[j]
+		if a.Script != b.Script {
+			return a.Script < b.Script
+		}
+		return positionLess(a.Position, b.Position)
+	})
+	return branches
+}
+
+// Loops returns all goto-loops that have been taken, the loop with the most executed lines first
+func (p *Profile) Loops() []LoopProfile {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	loops := make([]LoopProfile, 0)
+	for _, scriptLoops := range p.loops {
+		for _, loop := range scriptLoops {
+			loops = append(loops, *loop)
+		}
+	}
+	sort.Slice(loops, func(i, j int) bool {
+		if loops[i].IterationLines != loops[j].IterationLines {
+			return loops[i].IterationLines > loops[j].IterationLines
+		}
+		if loops[i].Script != loops[j].Script {
+			return loops[i].Script < loops[j].Script
+		}
+		return loops[i].From < loops[j].From
+	})
+	return loops
+}
+
+func sortedProfileEntries(counts map[profileKey]int) []ProfileEntry {
+	entries := make([]ProfileEntry, 0, len(counts))
+	for key, count := range counts {
+		entries = append(entries, ProfileEntry{
+			Script:     key.script,
+			Position:   key.position,
+			Executions: count,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Executions != b.Executions {
+			return a.Executions > b.Executions
+		}
+		if a.Script != b.Script {
+			return a.Script < b.Script
+		}
+		return positionLess(a.Position, b.Position)
+	})
+	return entries
+}
+
+// positionLess returns true if a is located before b
+func positionLess(a ast.Position, b ast.Position) bool {
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Coloumn < b.Coloumn
+}
+
+// lineStarted is called when the vm starts executing the given ast-line
+func (p *Profile) lineStarted(v *VM, astLine int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.totalLines++
+	p.lines[profileKey{p.scripts[v], ast.Position{Line: astLine}}]++
+	p.touched[v] = make(map[ast.Position]bool)
+}
+
+// statementEntered is called when the vm starts executing the statement at the given position
+func (p *Profile) statementEntered(v *VM, pos ast.Position) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	script := p.scripts[v]
+	p.statements[profileKey{script, pos}]++
+	line := ast.Position{File: pos.File, Line: pos.Line}
+	if touched := p.touched[v]; touched != nil && !touched[line] {
+		touched[line] = true
+		p.sourceLines[profileKey{script, line}]++
+	}
+}
+
+// branchEvaluated is called when the vm evaluated the condition of the if-statement at the given position
+func (p *Profile) branchEvaluated(v *VM, pos ast.Position, taken bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	key := profileKey{p.scripts[v], pos}
+	branch, exists := p.branches[key]
+	if !exists {
+		branch = &BranchProfile{
+			Script:   key.script,
+			Position: pos,
+		}
+		p.branches[key] = branch
+	}
+	if taken {
+		branch.Taken++
+	} else {
+		branch.Skipped++
+	}
+}
+
+// countBranch counts the outcome of the condition of an if-statement in the profile (if any)
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) countBranch(stmt *ast.IfStatement, taken bool) {
+	if v.profile != nil {
+		v.profile.branchEvaluated(v, stmt.Start(), taken)
+	}
+}
+
+// jumped is called when the vm jumps from one ast-line to another.
+// executedLines and now are the number of lines executed by the vm and the current simulated time
+func (p *Profile) jumped(v *VM, from int, to int, executedLines int, now time.Duration) {
+	// only backward-jumps form loops
+	if to > from {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	script := p.scripts[v]
+	if p.loops[script] == nil {
+		p.loops[script] = make(map[jump]*LoopProfile)
+	}
+	key := jump{from, to}
+	loop, exists := p.loops[script][key]
+	if !exists {
+		loop = &LoopProfile{
+			Script: script,
+			From:   from,
+			To:     to,
+		}
+		p.loops[script][key] = loop
+	}
+	loop.Taken++
+	if last, exists := p.lastJumps[v][key]; exists {
+		loop.Iterations++
+		loop.IterationLines += executedLines - last.executedLines
+		loop.IterationTime += now - last.time
+	}
+	p.lastJumps[v][key] = jumpMark{
+		executedLines: executedLines,
+		time:          now,
+	}
+}
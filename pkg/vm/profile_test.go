@@ -0,0 +1,54 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestProfile(t *testing.T) {
+	coord := vm.NewCoordinator()
+	v, _ := vm.CreateSyncFromSource("a = 0\na++ b = a\nif a < 3 then goto 2 end\ngoto 1")
+	v.SetCoordinator(coord)
+	profile := vm.NewProfile()
+	v.SetProfile(profile, "main.yolol")
+	v.Resume()
+	// line 1, then 3 times lines 2-3, then line 4
+	for i := 0; i < 8; i++ {
+		coord.Tick()
+	}
+
+	if profile.TotalLines() != 8 {
+		t.Fatalf("Wrong number of total lines: %d", profile.TotalLines())
+	}
+	lines := profile.Lines()
+	if lines[0].Position.Line != 2 || lines[0].Executions != 3 || lines[1].Position.Line != 3 || lines[1].Executions != 3 {
+		t.Fatalf("Wrong hot lines: %v", lines)
+	}
+	statements := profile.Statements()
+	if len(statements) != 6 || statements[0].Position.Line != 2 || statements[0].Position.Coloumn != 1 || statements[1].Position.Coloumn != 5 {
+		t.Fatalf("Wrong statement counts: %v", statements)
+	}
+	sourceLines := profile.SourceLines()
+	if len(sourceLines) != 4 || sourceLines[0].Executions != 3 {
+		t.Fatalf("Wrong source-line counts: %v", sourceLines)
+	}
+
+	branches := profile.Branches()
+	if len(branches) != 1 || branches[0].Position.Line != 3 || branches[0].Taken != 2 || branches[0].Skipped != 1 {
+		t.Fatalf("Wrong branch counts: %v", branches)
+	}
+
+	loops := profile.Loops()
+	if len(loops) != 2 {
+		t.Fatalf("Wrong number of loops: %v", loops)
+	}
+	inner := loops[0]
+	if inner.From != 3 || inner.To != 2 || inner.Taken != 2 || inner.Iterations != 1 || inner.AverageLines() != 2 || inner.AverageTime() != 400*time.Millisecond {
+		t.Fatalf("Wrong profile for the inner loop: %+v", inner)
+	}
+	if loops[1].From != 4 || loops[1].Taken != 1 || loops[1].Iterations != 0 {
+		t.Fatalf("Wrong profile for the outer loop: %+v", loops[1])
+	}
+}
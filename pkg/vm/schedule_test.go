@@ -0,0 +1,44 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func runOrder(seed *int64) string {
+	coord := vm.NewCoordinator()
+	for _, prog := range []string{`:order += "a"`, `:order += "b"`, `:order += "c"`} {
+		v, _ := vm.CreateSyncFromSource(prog)
+		v.SetCoordinator(coord)
+		v.Resume()
+	}
+	coord.SetVariable(":order", &vm.Variable{Value: ""})
+	coord.SetTimeLimit(2 * time.Second)
+	if seed != nil {
+		coord.SetScheduleSeed(*seed)
+	}
+	for coord.Tick() {
+	}
+	order, _ := coord.GetVariable(":order")
+	return order.String()
+}
+
+func TestScheduleSeed(t *testing.T) {
+	fixed := runOrder(nil)
+	if fixed != "abcabcabcabcabcabcabcabcabcabc" {
+		t.Fatalf("Wrong default order: %s", fixed)
+	}
+	seed := int64(42)
+	randomized := runOrder(&seed)
+	if randomized == fixed {
+		t.Fatal("The seed did not change the order of execution")
+	}
+	if len(randomized) != len(fixed) {
+		t.Fatalf("The seed must not change the number of executed lines: %s", randomized)
+	}
+	if replayed := runOrder(&seed); replayed != randomized {
+		t.Fatalf("Replaying the seed resulted in a different order: %s vs %s", replayed, randomized)
+	}
+}
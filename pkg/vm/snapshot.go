@@ -0,0 +1,253 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+// VMSnapshot contains the serializable state of a VM
+// Variables are stored using their string-representation (see Variable.Repr())
+type VMSnapshot struct {
+	Variables            map[string]string     `json:"variables"`
+	CurrentAstLine       int                   `json:"currentAstLine"`
+	CurrentSourceLine    int                   `json:"currentSourceLine"`
+	CurrentSourceColoumn int                   `json:"currentSourceColoumn"`
+	Jumped               bool                  `json:"jumped"`
+	ExecutedLines        int                   `json:"executedLines"`
+	Breakpoints          []*BreakpointSnapshot `json:"breakpoints"`
+	State                int                   `json:"state"`
+}
+
+// BreakpointSnapshot contains the serializable state of a breakpoint (see Breakpoint)
+type BreakpointSnapshot struct {
+	Line         int    `json:"line"`
+	Column       int    `json:"column,omitempty"`
+	Condition    string `json:"condition,omitempty"`
+	HitCondition string `json:"hitCondition,omitempty"`
+	LogMessage   string `json:"logMessage,omitempty"`
+	Hits         int    `json:"hits,omitempty"`
+}
+
+// CoordinatorSnapshot contains the serializable state of a coordinator and all the VMs registered to it
+type CoordinatorSnapshot struct {
+	Globals map[string]string `json:"globals"`
+	// VMs contains the snapshots of the coordinated VMs in the order they have been registered
+	VMs []*VMSnapshot `json:"vms"`
+	// Now is the simulated time at which the snapshot has been taken
+	Now time.Duration `json:"now"`
+	// NextLineTimes contains the simulated time at which each vm runs its next line. Indexed like VMs
+	NextLineTimes []time.Duration `json:"nextLineTimes"`
+}
+
+// Snapshot returns the current state of the VM.
+// Snapshots are taken with line-granularity. If the VM is paused in the middle of a line
+// (e.g. by a breakpoint), the snapshot will point to the beginning of that line.
+func (v *VM) Snapshot() *VMSnapshot {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	snap := &VMSnapshot{
+		Variables:            make(map[string]string, len(v.variables)),
+		CurrentAstLine:       v.currentAstLine,
+		CurrentSourceLine:    v.currentSourceLine,
+		CurrentSourceColoumn: v.currentSourceColoumn,
+		Jumped:               v.jumped,
+		ExecutedLines:        v.executedLines,
+		Breakpoints:          make([]*BreakpointSnapshot, 0, len(v.breakpoints)),
+		State:                v.state,
+	}
+
+	// the current line has already been run, but the vm did not yet advance to the next one
+	if v.lineFinished {
+		if !v.relocatedAfterLine {
+			snap.CurrentAstLine++
+		}
+		snap.ExecutedLines++
+	}
+	if snap.CurrentAstLine > 20 {
+		snap.CurrentAstLine = 1
+	}
+
+	for name, value := range v.variables {
+		snap.Variables[name] = value.Repr()
+	}
+	for _, bp := range v.breakpoints {
+		snap.Breakpoints = append(snap.Breakpoints, bp.snapshot())
+	}
+	for _, columns := range v.columnBreakpoints {
+		for _, bp := range columns {
+			snap.Breakpoints = append(snap.Breakpoints, bp.snapshot())
+		}
+	}
+	sort.Slice(snap.Breakpoints, func(i, j int) bool {
+		if snap.Breakpoints[i].Line != snap.Breakpoints[j].Line {
+			return snap.Breakpoints[i].Line < snap.Breakpoints[j].Line
+		}
+		return snap.Breakpoints[i].Column < snap.Breakpoints[j].Column
+	})
+	return snap
+}
+
+// snapshot returns the serializable state of the breakpoint
+func (b *Breakpoint) snapshot() *BreakpointSnapshot {
+	return &BreakpointSnapshot{
+		Line:         b.Line,
+		Column:       b.Column,
+		Condition:    b.Condition,
+		HitCondition: b.HitCondition,
+		LogMessage:   b.LogMessage,
+		Hits:         b.hits,
+	}
+}
+
+// Restore sets the state of the VM to the state recorded in the given snapshot.
+// The VM MUST NOT have started executing yet. Restore it directly after creating it.
+// The restored VM remains paused, no matter what state is recorded in the snapshot.
+func (v *VM) Restore(snap *VMSnapshot) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.started {
+		return fmt.Errorf("Can not restore a snapshot into a vm that has already started execution")
+	}
+	if snap.CurrentAstLine < 1 || snap.CurrentAstLine > 20 {
+		return fmt.Errorf("Invalid line-number in snapshot: %d", snap.CurrentAstLine)
+	}
+
+	breakpoints := make(map[int]*Breakpoint, len(snap.Breakpoints))
+	columnBreakpoints := make(map[int]map[int]*Breakpoint)
+	for _, bpsnap := range snap.Breakpoints {
+		bp, err := NewBreakpoint(bpsnap.Line, bpsnap.Condition, bpsnap.HitCondition, bpsnap.LogMessage)
+		if err != nil {
+			return fmt.Errorf("Invalid breakpoint in snapshot at line %d: %s", bpsnap.Line, err.Error())
+		}
+		bp.Column = bpsnap.Column
+		bp.hits = bpsnap.Hits
+		if bp.Column > 0 {
+			if columnBreakpoints[bp.Line] == nil {
+				columnBreakpoints[bp.Line] = make(map[int]*Breakpoint)
+			}
+			columnBreakpoints[bp.Line][bp.Column] = bp
+		} else {
+			breakpoints[bp.Line] = bp
+		}
+	}
+
+	v.variables = make(map[string]*Variable, len(snap.Variables))
+	v.resetSlots()
+	for name, value := range snap.Variables {
+		v.storeLocal(name, VariableFromString(value))
+	}
+	v.breakpoints = breakpoints
+	v.columnBreakpoints = columnBreakpoints
+	v.currentAstLine = snap.CurrentAstLine
+	v.currentSourceLine = snap.CurrentSourceLine
+	v.currentSourceColoumn = snap.CurrentSourceColoumn
+	v.jumped = snap.Jumped
+	v.executedLines = snap.ExecutedLines
+	return nil
+}
+
+// Snapshot returns the current state of the global variables and of all coordinated VMs
+func (c *Coordinator) Snapshot() *CoordinatorSnapshot {
+	vms := c.registeredVMs()
+
+	snap := &CoordinatorSnapshot{
+		Globals: make(map[string]string),
+		VMs:     make([]*VMSnapshot, len(vms)),
+	}
+	for name, value := range c.GetVariables() {
+		snap.Globals[name] = value.Repr()
+	}
+	finished := make([]bool, len(vms))
+	for i, v := range vms {
+		snap.VMs[i] = v.Snapshot()
+		v.lock.Lock()
+		finished[i] = v.lineFinished && !v.synchronous
+		v.lock.Unlock()
+	}
+
+	c.vmLock.Lock()
+	defer c.vmLock.Unlock()
+	snap.Now = c.now
+	snap.NextLineTimes = make([]time.Duration, len(c.nextLineTimes))
+	for i := range c.nextLineTimes {
+		snap.NextLineTimes[i] = c.nextLineTimes[i]
+		// a (non-synchronous) vm paused after finishing a line has not yet reported the line to the coordinator,
+		// but its snapshot already points to the next line
+		if i < len(finished) && finished[i] {
+			snap.NextLineTimes[i] += c.lineInterval(c.vms[i])
+		}
+	}
+	return snap
+}
+
+// Restore sets the global variables, the simulated time and the states of the coordinated VMs to the values in the snapshot.
+// The VMs in the snapshot are matched with the registered VMs by their registration-order.
+// Must be called before Run().
+func (c *Coordinator) Restore(snap *CoordinatorSnapshot) error {
+	vms := c.registeredVMs()
+
+	if len(snap.VMs) != len(vms) {
+		return fmt.Errorf("The snapshot contains %d vms, but %d vms are registered with the coordinator", len(snap.VMs), len(vms))
+	}
+	if snap.NextLineTimes != nil && len(snap.NextLineTimes) != len(vms) {
+		return fmt.Errorf("The snapshot contains %d line-times, but %d vms are registered with the coordinator", len(snap.NextLineTimes), len(vms))
+	}
+
+	for i, v := range vms {
+		err := v.Restore(snap.VMs[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	c.vmLock.Lock()
+	c.now = snap.Now
+	for i := range c.nextLineTimes {
+		if snap.NextLineTimes != nil {
+			c.nextLineTimes[i] = snap.NextLineTimes[i]
+		} else {
+			c.nextLineTimes[i] = snap.Now
+		}
+	}
+	c.vmLock.Unlock()
+
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	c.networks = map[string]map[string]*Variable{DefaultNetwork: make(map[string]*Variable)}
+	for qualified, value := range snap.Globals {
+		network, name := SplitQualifiedName(qualified)
+		if _, exists := c.networks[network]; !exists {
+			c.networks[network] = make(map[string]*Variable)
+		}
+		c.networks[network][name] = VariableFromString(value)
+	}
+	return nil
+}
+
+// SaveSnapshot writes the given snapshot as json to the given file
+func SaveSnapshot(file string, snap *CoordinatorSnapshot) error {
+	content, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, content, 0644)
+}
+
+// LoadSnapshot loads a snapshot that has been written using SaveSnapshot
+func LoadSnapshot(file string) (*CoordinatorSnapshot, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var snap CoordinatorSnapshot
+	err = json.Unmarshal(content, &snap)
+	if err != nil {
+		return nil, fmt.Errorf("The provided snapshot-file is invalid: %s", err.Error())
+	}
+	return &snap, nil
+}
@@ -0,0 +1,172 @@
+package vm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	prog := `a = 0
+a++
+b = a * 2
+if a < 10 then goto 2 end
+:done = 1
+`
+	vm1, _ := vm.CreateFromSource(prog)
+	paused := make(chan struct{})
+	vm1.SetLineExecutedHandler(func(v *vm.VM) bool {
+		a, _ := v.GetVariable("a")
+		if v.CurrentAstLine() == 3 && a.Number().Int() == 5 {
+			paused <- struct{}{}
+			return false
+		}
+		return true
+	})
+	vm1.AddBreakpoint(4)
+	columnbp, _ := vm.NewBreakpoint(4, "a > 7", ">2", "")
+	columnbp.Column = 1
+	vm1.AddConditionalBreakpoint(columnbp)
+	vm1.Resume()
+	<-paused
+
+	dir, err := ioutil.TempDir("", "yodk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+
+	err = vm.SaveSnapshot(file, &vm.CoordinatorSnapshot{
+		VMs: []*vm.VMSnapshot{vm1.Snapshot()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm1.Terminate()
+
+	snap, err := vm.LoadSnapshot(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snap.VMs[0].CurrentAstLine != 4 {
+		t.Fatalf("Snapshot should point to line 4, but points to %d", snap.VMs[0].CurrentAstLine)
+	}
+
+	vm2, _ := vm.CreateFromSource(prog)
+	err = vm2.Restore(snap.VMs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vm2.ListBreakpoints()) != 1 {
+		t.Fatal("Breakpoints have not been restored")
+	}
+	if bp := vm2.GetBreakpoint(4, 1); bp == nil || bp.Condition != "a > 7" || bp.HitCondition != ">2" {
+		t.Fatalf("The conditional breakpoint has not been restored: %+v", bp)
+	}
+	vm2.RemoveBreakpoint(4)
+	vm2.SetLineExecutedHandler(vm.TerminateOnDoneVar)
+	vm2.Resume()
+	vm2.WaitForTermination()
+
+	if err := vm2.Restore(snap.VMs[0]); err == nil {
+		t.Fatal("Restoring into a vm that already ran should fail")
+	}
+
+	b, _ := vm2.GetVariable("b")
+	if b.Number().Int() != 20 {
+		t.Fatalf("Wrong value for b after restoring. Wanted 20 but got %s", b.Repr())
+	}
+
+	reference, _ := vm.CreateFromSource(prog)
+	reference.SetLineExecutedHandler(vm.TerminateOnDoneVar)
+	reference.Resume()
+	reference.WaitForTermination()
+	if vm2.GetExecutedLines() != reference.GetExecutedLines() {
+		t.Fatalf("Wrong number of executed lines. Wanted %d but got %d", reference.GetExecutedLines(), vm2.GetExecutedLines())
+	}
+}
+
+func TestCoordinatorSnapshotTime(t *testing.T) {
+	create := func() *vm.Coordinator {
+		coord := vm.NewCoordinator()
+		for i, prog := range []string{"a++ :x = a goto 1", "b++ :y = b goto 1"} {
+			v, _ := vm.CreateSyncFromSource(prog)
+			v.SetCoordinator(coord)
+			coord.SetLinesPerSecond(v, float64(5-3*i))
+			v.Resume()
+		}
+		coord.SetTimeLimit(6 * time.Second)
+		return coord
+	}
+
+	reference := create()
+	for reference.Tick() {
+	}
+
+	first := create()
+	for first.Now() < 3*time.Second && first.Tick() {
+	}
+	snap := first.Snapshot()
+	if snap.Now != first.Now() {
+		t.Fatalf("Wrong time in snapshot: %s", snap.Now)
+	}
+
+	second := create()
+	err := second.Restore(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Now() != snap.Now {
+		t.Fatalf("The simulated time has not been restored: %s", second.Now())
+	}
+	for second.Tick() {
+	}
+
+	for _, name := range []string{":x", ":y"} {
+		want, _ := reference.GetVariable(name)
+		got, _ := second.GetVariable(name)
+		if !got.Equals(want) {
+			t.Fatalf("Wrong value for %s after restoring. Wanted %s but got %s", name, want.Repr(), got.Repr())
+		}
+	}
+
+	// a vm paused by a handler has finished its line, but not yet reported it to the coordinator
+	async := vm.NewCoordinator()
+	v, _ := vm.CreateFromSource("a++ :x = a goto 1")
+	v.SetCoordinator(async)
+	paused := make(chan struct{})
+	v.SetLineExecutedHandler(func(x *vm.VM) bool {
+		a, _ := x.GetVariable("a")
+		if a.Number().Int() == 10 {
+			close(paused)
+			return false
+		}
+		return true
+	})
+	v.Resume()
+	async.Run()
+	<-paused
+	snap = async.Snapshot()
+	async.Terminate()
+
+	single := vm.NewCoordinator()
+	v, _ = vm.CreateSyncFromSource("a++ :x = a goto 1")
+	v.SetCoordinator(single)
+	v.Resume()
+	single.SetTimeLimit(6 * time.Second)
+	err = single.Restore(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for single.Tick() {
+	}
+	if x, _ := single.GetVariable(":x"); x.Number().Int() != 30 {
+		t.Fatalf("Wrong value for :x after restoring. Wanted 30 but got %s", x.Repr())
+	}
+}
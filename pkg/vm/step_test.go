@@ -0,0 +1,48 @@
+package vm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestStatementStepping(t *testing.T) {
+	testStatementStepping(t, vm.EngineInterpreter)
+}
+
+func testStatementStepping(t *testing.T, engine int) {
+	prog := `a = 1 b = 2 if a == 1 then c = 3 end
+x = 1 goto 1
+`
+	v, _ := vm.CreateFromSource(prog)
+	v.SetEngine(engine)
+	stops := make(chan string, 10)
+	v.SetStepHandler(func(x *vm.VM) {
+		stops <- fmt.Sprintf("%d:%d", x.CurrentSourceLine(), x.CurrentSourceColoumn())
+	})
+	v.SetBreakpointHandler(func(x *vm.VM) bool {
+		stops <- fmt.Sprintf("bp %d:%d", x.CurrentSourceLine(), x.CurrentSourceColoumn())
+		return false
+	})
+	bp, _ := vm.NewBreakpoint(1, "", "", "")
+	bp.Column = 7
+	v.AddConditionalBreakpoint(bp)
+
+	v.Resume()
+	got := []string{<-stops}
+	for i := 0; i < 4; i++ {
+		v.StepStatement()
+		got = append(got, <-stops)
+	}
+	for i := 0; i < 2; i++ {
+		v.Step()
+		got = append(got, <-stops)
+	}
+
+	expected := []string{"bp 1:7", "1:13", "1:28", "2:1", "2:7", "1:1", "bp 1:7"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("Wrong stops. Wanted %v but got %v", expected, got)
+	}
+	v.Terminate()
+}
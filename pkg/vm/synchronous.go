@@ -0,0 +1,149 @@
+package vm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// CreateSync creates a new synchronous VM to run the given program.
+// A synchronous vm has no goroutine of its own. Instead the caller executes lines using RunLines()
+// (or Coordinator.Tick() for coordinated vms).
+// As the vm can not block while executing a line, pausing (e.g. by a breakpoint, a step or a handler)
+// does not interrupt the current line. Instead RunLines() returns once the current line is completed.
+// The returned VM is paused. Configure it using the setters and then call Resume()
+func CreateSync(prog *ast.Program) *VM {
+	vm := newVM(prog)
+	vm.synchronous = true
+	return vm
+}
+
+// CreateSyncFromSource creates a new synchronous VM to run the given program. See CreateSync()
+// The returned VM is paused. Configure it using the setters and then call Resume()
+func CreateSyncFromSource(prog string) (*VM, error) {
+	ast, err := parser.NewParser().Parse(prog)
+	if err != nil {
+		return nil, err
+	}
+	return CreateSync(ast), nil
+}
+
+// IsSynchronous returns true if the vm has been created using CreateSync()
+func (v *VM) IsSynchronous() bool {
+	return v.synchronous
+}
+
+// RunLines executes up to n lines on the calling goroutine and returns the number of executed lines.
+// Execution stops early if the vm is paused (e.g. by a breakpoint) or terminates.
+// A paused vm does not execute any line. Call Resume() first.
+// Can only be used with synchronous vms (see CreateSync()).
+func (v *VM) RunLines(n int) (int, error) {
+	return v.runLines(n, false)
+}
+
+// runLines executes up to n lines. If programLinesOnly is true, the empty lines after the end of the program
+// are not counted. This matches the behaviour of coordinated vms, where these lines are executed without
+// waiting for the coordinator.
+func (v *VM) runLines(n int, programLinesOnly bool) (executed int, err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if !v.synchronous {
+		return 0, fmt.Errorf("RunLines can only be used with synchronous vms")
+	}
+	if v.state == StateTerminated {
+		return 0, nil
+	}
+
+	v.runningLines = true
+	defer func() {
+		v.runningLines = false
+		reason := recover()
+		if reason != nil && reason != errKillVM {
+			panic(reason)
+		}
+		if reason != nil || v.state == StateTerminated {
+			v.finish()
+		}
+	}()
+
+	if !v.started {
+		// compensate the increment done by advanceLine()
+		// necessary because of the pesky 1-indexing of lines
+		v.currentAstLine--
+		v.started = true
+	}
+
+	for executed < n && v.state != StatePaused && v.state != StateTerminated {
+		v.advanceLine()
+		// roll back to line 1
+		if v.currentAstLine > 20 {
+			v.currentAstLine = 1
+		}
+
+		inProgram := v.currentAstLine-1 < len(v.program.Lines) || len(v.program.Lines) == 0
+		if !v.executeCurrentLine() {
+			continue
+		}
+		if inProgram || !programLinesOnly {
+			executed++
+		}
+		v.countExecutedLine()
+	}
+
+	return executed, nil
+}
+
+// requestStateSync applies a requested state to a synchronous vm
+func (v *VM) requestStateSync(state int) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.state == StateTerminated {
+		return
+	}
+	v.state = state
+	// if RunLines() is currently executing, it takes care of the termination
+	if state == StateTerminated && !v.runningLines {
+		v.finish()
+	}
+}
+
+// Tick runs all lines that are due at the next point in simulated time (see Coordinator.Now()).
+// If all vms run at the same speed, this runs the next line of every vm, in the order the vms have been registered.
+// All coordinated vms MUST be synchronous (see CreateSync()). Do not call Run() when using Tick().
+// Terminated vms are skipped. If a vm is paused when its line is due, the tick stops before this vm
+// and the next call to Tick() continues with it, so the order of execution is always preserved.
+// Returns false once all coordinated vms have terminated.
+func (c *Coordinator) Tick() bool {
+	vms := c.registeredVMs()
+	ticked := false
+	var tickTime time.Duration
+	for {
+		i, due := c.nextScheduled(true)
+		if i < 0 {
+			return false
+		}
+		if ticked && due != tickTime {
+			return true
+		}
+		c.updateDevices()
+		c.runScheduledCalls()
+		if c.timeLimitReached(i) {
+			c.terminateRunning()
+			return false
+		}
+		if vms[i].State() == StatePaused {
+			return true
+		}
+		vms[i].runLines(1, true)
+		c.lineDone(i)
+		if c.checkIdle(vms[i]) {
+			c.terminateRunning()
+			return false
+		}
+		ticked = true
+		tickTime = due
+	}
+}
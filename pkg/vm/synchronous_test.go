@@ -0,0 +1,83 @@
+package vm_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestRunLines(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	v, _ := vm.CreateSyncFromSource(`a++ goto 1`)
+	if runtime.NumGoroutine() != goroutines {
+		t.Fatal("A synchronous vm must not start a goroutine")
+	}
+
+	executed, _ := v.RunLines(5)
+	if executed != 0 {
+		t.Fatal("A paused vm must not execute lines")
+	}
+
+	v.Resume()
+	executed, err := v.RunLines(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := v.GetVariable("a")
+	if executed != 5 || a.Itoa() != "5" {
+		t.Fatalf("Wrong result after running 5 lines: executed=%d, a=%s", executed, a.Itoa())
+	}
+
+	hit := false
+	v.SetBreakpointHandler(func(x *vm.VM) bool {
+		hit = true
+		return false
+	})
+	v.AddBreakpoint(1)
+	executed, _ = v.RunLines(5)
+	if !hit || executed != 1 || v.State() != vm.StatePaused {
+		t.Fatalf("The breakpoint should have stopped the execution after one line. Executed %d lines", executed)
+	}
+	v.RemoveBreakpoint(1)
+
+	finished := false
+	v.SetFinishHandler(func(x *vm.VM) {
+		finished = true
+	})
+	v.SetMaxExecutedLines(10)
+	v.Resume()
+	executed, _ = v.RunLines(100)
+	if executed != 5 || !finished || v.State() != vm.StateTerminated {
+		t.Fatalf("The vm should have terminated after 10 lines. Executed %d lines", executed)
+	}
+	v.WaitForTermination()
+}
+
+func TestCoordinatorTick(t *testing.T) {
+	prog1 := `:result = ""
+:result += "b"
+:result += "d"
+`
+	prog2 := `:result += "a"
+:result += "c"
+:result += "e"
+`
+	coord := vm.NewCoordinator()
+	vm1, _ := vm.CreateSyncFromSource(prog1)
+	vm2, _ := vm.CreateSyncFromSource(prog2)
+	for _, v := range []*vm.VM{vm1, vm2} {
+		v.SetCoordinator(coord)
+		v.SetMaxExecutedLines(3)
+		v.Resume()
+	}
+
+	ticks := 0
+	for coord.Tick() {
+		ticks++
+	}
+	result, _ := coord.GetVariable(":result")
+	if result.String() != "abcde" || ticks != 3 {
+		t.Fatalf("Wrong result after %d ticks: '%s'", ticks, result.String())
+	}
+}
@@ -0,0 +1,208 @@
+package vm
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceEntry describes a single executed line
+type TraceEntry struct {
+	// the name of the run this line belongs to (see Trace.BeginRun())
+	Run string
+	// the name of the script that executed the line
+	Script string
+	// the simulated time at which the line started (see Coordinator.Now()). 0 for uncoordinated vms
+	Time time.Duration
+	// the scheduling round of the coordinator the line ran in. The first lines run at tick 1 and a tick lasts as long as
+	// one line of a chip running at the default speed (200ms). 0 for uncoordinated vms
+	Tick int
+	// the source-line that has been executed
+	Line int
+	// the number of lines the vm had executed before executing this line
+	ExecutedLines int
+	// all writes to variables performed by the line, in the order they happened
+	Writes []VariableWrite
+	// the line the execution jumped to using goto. 0 if the line did not jump
+	JumpTarget int
+	// the runtime-error that aborted the line, if any
+	Error error
+}
+
+// Trace records every line executed by one or more VMs. In contrast to History, a trace is never truncated.
+// It is meant to be exported (see WriteJSONLines() and WriteCSV()) and compared with other traces.
+type Trace struct {
+	lock    *sync.Mutex
+	entries []TraceEntry
+	run     string
+	scripts map[*VM]string
+}
+
+// NewTrace returns a new, empty trace
+func NewTrace() *Trace {
+	return &Trace{
+		lock:    &sync.Mutex{},
+		entries: make([]TraceEntry, 0),
+		scripts: make(map[*VM]string),
+	}
+}
+
+// BeginRun marks all lines recorded from now on as belonging to the run with the given name.
+// This is used to distinguish multiple runs (like the cases of a test) in one trace
+func (t *Trace) BeginRun(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.run = name
+}
+
+// Entries returns a copy of the recorded entries in the order of execution
+func (t *Trace) Entries() []TraceEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	li := make([]TraceEntry, len(t.entries))
+	copy(li, t.entries)
+	return li
+}
+
+// add records the executed line described by e
+// Is called by the vm of the entry while it holds its lock
+func (t *Trace) add(e *HistoryEntry) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	writes := make([]VariableWrite, len(e.Writes))
+	copy(writes, e.Writes)
+	tick := 0
+	if e.VM.coordinator != nil {
+		tick = tickAt(e.Time)
+	}
+	t.entries = append(t.entries, TraceEntry{
+		Run:           t.run,
+		Script:        t.scripts[e.VM],
+		Time:          e.Time,
+		Tick:          tick,
+		Line:          e.SourceLine,
+		ExecutedLines: e.ExecutedLines,
+		Writes:        writes,
+		JumpTarget:    e.JumpTarget,
+		Error:         e.Err,
+	})
+}
+
+// SetTrace makes the vm record all executed lines into the given trace. script is the name used for the vm in the trace
+func (v *VM) SetTrace(t *Trace, script string) {
+	t.lock.Lock()
+	t.scripts[v] = script
+	t.lock.Unlock()
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.trace = t
+}
+
+// jsonTraceWrite is the json-representation of a VariableWrite
+type jsonTraceWrite struct {
+	Name string  `json:"name"`
+	Old  *string `json:"old"`
+	New  *string `json:"new"`
+}
+
+// jsonTraceEntry is the json-representation of a TraceEntry
+type jsonTraceEntry struct {
+	Run           string           `json:"run,omitempty"`
+	Script        string           `json:"script"`
+	TimeMs        float64          `json:"time_ms"`
+	Tick          int              `json:"tick"`
+	Line          int              `json:"line"`
+	ExecutedLines int              `json:"executed_lines"`
+	Writes        []jsonTraceWrite `json:"writes"`
+	JumpTarget    int              `json:"jump,omitempty"`
+	Error         string           `json:"error,omitempty"`
+}
+
+// reprOrNil returns the representation of the variable, or nil if the variable does not exist
+func reprOrNil(v *Variable) *string {
+	if v == nil {
+		return nil
+	}
+	repr := v.Repr()
+	return &repr
+}
+
+// WriteJSONLines writes the trace to w. Every executed line is written as a json-object on a line of its own
+func (t *Trace) WriteJSONLines(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, e := range t.Entries() {
+		out := jsonTraceEntry{
+			Run:           e.Run,
+			Script:        e.Script,
+			TimeMs:        float64(e.Time) / float64(time.Millisecond),
+			Tick:          e.Tick,
+			Line:          e.Line,
+			ExecutedLines: e.ExecutedLines,
+			Writes:        make([]jsonTraceWrite, len(e.Writes)),
+			JumpTarget:    e.JumpTarget,
+		}
+		for i, write := range e.Writes {
+			out.Writes[i] = jsonTraceWrite{
+				Name: write.Name,
+				Old:  reprOrNil(write.Old),
+				New:  reprOrNil(write.New),
+			}
+		}
+		if e.Error != nil {
+			out.Error = e.Error.Error()
+		}
+		err := encoder.Encode(out)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the trace as csv to w. The writes of a line are combined into a single column
+func (t *Trace) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"run", "script", "time_ms", "tick", "line", "executed_lines", "writes", "jump", "error"})
+	if err != nil {
+		return err
+	}
+	for _, e := range t.Entries() {
+		writes := make([]string, len(e.Writes))
+		for i, write := range e.Writes {
+			old := "<unset>"
+			if write.Old != nil {
+				old = write.Old.Repr()
+			}
+			writes[i] = fmt.Sprintf("%s: %s -> %s", write.Name, old, write.New.Repr())
+		}
+		jump := ""
+		if e.JumpTarget > 0 {
+			jump = strconv.Itoa(e.JumpTarget)
+		}
+		errmsg := ""
+		if e.Error != nil {
+			errmsg = e.Error.Error()
+		}
+		err = writer.Write([]string{
+			e.Run,
+			e.Script,
+			strconv.FormatFloat(float64(e.Time)/float64(time.Millisecond), 'f', -1, 64),
+			strconv.Itoa(e.Tick),
+			strconv.Itoa(e.Line),
+			strconv.Itoa(e.ExecutedLines),
+			strings.Join(writes, "; "),
+			jump,
+			errmsg,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
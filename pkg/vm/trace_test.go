@@ -0,0 +1,62 @@
+package vm_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestTrace(t *testing.T) {
+	coord := vm.NewCoordinator()
+	v, _ := vm.CreateSyncFromSource("a = 1 :b = a\nc = 1 / 0\ngoto 1")
+	v.SetCoordinator(coord)
+	v.SetErrorMode(vm.ErrorModeAbortLine)
+	trace := vm.NewTrace()
+	trace.BeginRun("first")
+	v.SetTrace(trace, "main.yolol")
+	v.Resume()
+	for i := 0; i < 4; i++ {
+		coord.Tick()
+	}
+
+	entries := trace.Entries()
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 entries but got %d", len(entries))
+	}
+	if len(entries[0].Writes) != 2 || entries[0].Writes[1].Name != ":b" || entries[0].Writes[1].Old != nil {
+		t.Fatalf("Wrong writes recorded: %v", entries[0].Writes)
+	}
+	if entries[1].Error == nil {
+		t.Fatal("The runtime-error has not been recorded")
+	}
+	if entries[2].JumpTarget != 1 {
+		t.Fatalf("The jump has not been recorded: %v", entries[2])
+	}
+	if entries[3].Time != 600*time.Millisecond || entries[3].Tick != 4 {
+		t.Fatalf("Wrong times recorded: %v", entries)
+	}
+
+	jsonl := &bytes.Buffer{}
+	err := trace.WriteJSONLines(jsonl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	expected := `{"run":"first","script":"main.yolol","time_ms":0,"tick":1,"line":1,"executed_lines":0,"writes":[{"name":"a","old":null,"new":"1"},{"name":":b","old":null,"new":"1"}]}`
+	if len(lines) != 4 || lines[0] != expected {
+		t.Fatalf("Wrong json-lines output:\n%s", jsonl.String())
+	}
+
+	csv := &bytes.Buffer{}
+	err = trace.WriteCSV(csv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 5 || lines[3] != "first,main.yolol,400,3,3,2,,1," {
+		t.Fatalf("Wrong csv output:\n%s", csv.String())
+	}
+}
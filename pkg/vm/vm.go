@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dbaumgarten/yodk/pkg/number"
 	"github.com/dbaumgarten/yodk/pkg/parser"
@@ -12,21 +13,31 @@ import (
 
 var errAbortLine = fmt.Errorf("")
 
+// errRelocated is returned when the vm has been moved to another line while it was paused in the middle of a line
+var errRelocated = fmt.Errorf("The vm has been relocated")
+
 // The current state of the VM
 const (
 	StatePaused     = iota
 	StateRunning    = iota
 	StateStepping   = iota
 	StateTerminated = iota
+	// like StateStepping, but pauses before every statement
+	StateSteppingStatement = iota
 )
 
 // BreakpointFunc is a function that is called when a breakpoint is encountered.
 // If true is returned the execution is resumed. Otherwise the vm remains paused
 type BreakpointFunc func(vm *VM) bool
 
-// ErrorHandlerFunc is a function that is called when a runtime-error is encountered.
+// WatchpointFunc is a function that is called when a watched variable is written by the executed code.
+// The name of the variable is normalized (lowercased).
 // If true is returned the execution is resumed. Otherwise the vm remains paused
-type ErrorHandlerFunc func(vm *VM, err error) bool
+type WatchpointFunc func(vm *VM, name string, oldValue *Variable, newValue *Variable) bool
+
+// ErrorHandlerFunc is a function that is called when a runtime-error is encountered.
+// The handler only observes the error. How the vm reacts to the error is configured using SetErrorMode()
+type ErrorHandlerFunc func(vm *VM, err error)
 
 // FinishHandlerFunc is a function that is called when the programm finished execution (looping is disabled)
 type FinishHandlerFunc func(vm *VM)
@@ -45,11 +56,31 @@ var TerminateOnDoneVar = func(vm *VM) bool {
 	return true
 }
 
+// Categories of runtime-errors (see RuntimeError.Kind)
+const (
+	// a division (or modulo) by zero
+	ErrKindDivisionByZero = "division-by-zero"
+	// a string has been used as the condition of an if
+	ErrKindStringCondition = "string-condition"
+	// a string has been used as the target of a goto
+	ErrKindStringGoto = "string-goto"
+	// an operator has been used on a type it is not available for
+	ErrKindTypeMismatch = "type-mismatch"
+	// -- has been used on an empty string
+	ErrKindEmptyString = "empty-string"
+	// any other error
+	ErrKindOther = "other"
+)
+
 // RuntimeError represents an error encountered during execution
 type RuntimeError struct {
 	Base error
 	// The Node that caused the error
 	Node ast.Node
+	// The category of the error (one of the ErrKind* constants)
+	Kind string
+	// The values the failing node operated on. Can be empty
+	Operands []*Variable
 }
 
 func (e RuntimeError) Error() string {
@@ -69,10 +100,16 @@ type VM struct {
 	variables map[string]*Variable
 	// event handlers
 	breakpointHandler   BreakpointFunc
+	watchpointHandler   WatchpointFunc
+	logHandler          LogFunc
 	stepHandler         FinishHandlerFunc
 	errorHandler        ErrorHandlerFunc
 	finishHandler       FinishHandlerFunc
 	lineExecutedHandler LineExecutedHandlerFunc
+	// the reaction to runtime-errors (one of the ErrorMode* constants)
+	errorMode int
+	// reactions to runtime-errors of specific kinds. Take precedence over errorMode
+	kindErrorModes map[string]int
 	// current line in the ast is 1-indexed
 	currentAstLine int
 	// current line in the source code
@@ -81,8 +118,12 @@ type VM struct {
 	currentSourceColoumn int
 	// if true we arrived at the current line via a goto
 	jumped bool
-	// list of active breakpoints
-	breakpoints map[int]bool
+	// active breakpoints by source-line
+	breakpoints map[int]*Breakpoint
+	// active breakpoints that target a specific statement. Indexed by source-line and coloumn
+	columnBreakpoints map[int]map[int]*Breakpoint
+	// set of watched variables (normalized names)
+	watchpoints map[string]bool
 	// current state of the vm
 	state int
 	// this channel is used to comminucate state-change-requests
@@ -99,25 +140,68 @@ type VM struct {
 	maxExecutedLines int
 	// number of lines executed in the current run
 	executedLines int
+	// true once the vm has started executing its first line
+	started bool
+	// true if the current line has been executed completely, but execution has not yet advanced to the next line
+	lineFinished bool
+	// the value of currentAstLine after the last completed line (the line before the next line to run)
+	finishedAstLine int
+	// true while the vm is executing a line (including being paused inside it)
+	runningLine bool
+	// true if the vm already paused (because of a step or breakpoint) before executing the current statement
+	stoppedAtStatement bool
+	// true if the vm has been moved to another line while being paused inside a line.
+	// the current line is aborted and execution continues at currentAstLine
+	relocated bool
+	// true if the vm has been moved to another line after the current line has been completed
+	// (e.g. while paused by the line-executed-handler). The completed line counts as executed and
+	// execution continues at currentAstLine instead of the line after it
+	relocatedAfterLine bool
+	// true if the vm has to give back its permission to run a line after aborting the current line (see yieldLine())
+	yielded bool
+	// if set, the executed lines are recorded to this history
+	history *History
+	// the history entry for the line that is currently executed
+	historyEntry *HistoryEntry
+	// if set, all executed lines are recorded into this trace
+	trace *Trace
+	// if set, executed lines and statements are counted in this profile
+	profile *Profile
+	// the compiled program. Only set when using EngineCompiled
+	compiled *compiledProgram
+	// the values of the variables used by the compiled program, indexed by slot
+	slots []*Variable
+	// if true, the vm has no goroutine of its own and is driven using RunLines()
+	synchronous bool
+	// true while RunLines() is executing
+	runningLines bool
 }
 
 // Create creates a new VM to run the given program in a seperate goroutine.
 // The returned VM is paused. Configure it using the setters and then call Resume()
 func Create(prog *ast.Program) *VM {
-	vm := &VM{
-		variables:      make(map[string]*Variable),
-		state:          StatePaused,
-		breakpoints:    make(map[int]bool),
-		lock:           &sync.Mutex{},
-		currentAstLine: 1,
+	vm := newVM(prog)
+	go vm.run()
+	return vm
+}
+
+// newVM creates a new (paused) vm for the given program without starting it
+func newVM(prog *ast.Program) *VM {
+	return &VM{
+		variables:         make(map[string]*Variable),
+		state:             StatePaused,
+		breakpoints:       make(map[int]*Breakpoint),
+		columnBreakpoints: make(map[int]map[int]*Breakpoint),
+		watchpoints:       make(map[string]bool),
+		kindErrorModes:    make(map[string]int),
+		lock:              &sync.Mutex{},
+		currentAstLine:    1,
 		// initialize to 0, so the first executed line triggers a lineChanged()
 		currentSourceLine:  0,
 		stateRequests:      make(chan int),
 		terminationChannel: make(chan interface{}),
 		program:            prog,
 	}
-	go vm.run()
-	return vm
 }
 
 // CreateFromSource creates a new VM to run the given program in a seperate goroutine.
@@ -150,14 +234,43 @@ func (v *VM) GetExecutedLines() int {
 func (v *VM) AddBreakpoint(line int) {
 	v.lock.Lock()
 	defer v.lock.Unlock()
-	v.breakpoints[line] = true
+	v.breakpoints[line] = &Breakpoint{
+		Line: line,
+	}
 }
 
-// RemoveBreakpoint removes the breakpoint at the line
+// RemoveBreakpoint removes the breakpoints at the line (including breakpoints for specific statements on that line)
 func (v *VM) RemoveBreakpoint(line int) {
 	v.lock.Lock()
 	defer v.lock.Unlock()
 	delete(v.breakpoints, line)
+	delete(v.columnBreakpoints, line)
+}
+
+// AddWatchpoint adds a watchpoint for the given variable.
+// Whenever the executed code writes to the variable, the watchpoint-handler is called
+func (v *VM) AddWatchpoint(name string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.watchpoints[strings.ToLower(name)] = true
+}
+
+// RemoveWatchpoint removes the watchpoint for the given variable
+func (v *VM) RemoveWatchpoint(name string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	delete(v.watchpoints, strings.ToLower(name))
+}
+
+// ListWatchpoints returns the names of all watched variables
+func (v *VM) ListWatchpoints() []string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	li := make([]string, 0, len(v.watchpoints))
+	for k := range v.watchpoints {
+		li = append(li, k)
+	}
+	return li
 }
 
 // PrintVariables gets an overview over the current variable state
@@ -189,6 +302,12 @@ func (v *VM) Step() {
 	v.requestState(StateStepping)
 }
 
+// StepStatement executes the next statement and pauses the execution
+// Blocks until the VM reacts on the request
+func (v *VM) StepStatement() {
+	v.requestState(StateSteppingStatement)
+}
+
 // Pause pauses the execution
 // Blocks until the VM reacts on the request
 func (v *VM) Pause() {
@@ -230,6 +349,13 @@ func (v *VM) SetBreakpointHandler(f BreakpointFunc) {
 	v.breakpointHandler = f
 }
 
+// SetWatchpointHandler sets the function to be called when a watched variable is written
+func (v *VM) SetWatchpointHandler(f WatchpointFunc) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.watchpointHandler = f
+}
+
 // SetStepHandler sets the function to be called when a step completes
 func (v *VM) SetStepHandler(f FinishHandlerFunc) {
 	v.lock.Lock()
@@ -275,6 +401,11 @@ func (v *VM) ListBreakpoints() []int {
 	for k := range v.breakpoints {
 		li = append(li, k)
 	}
+	for k := range v.columnBreakpoints {
+		if _, exists := v.breakpoints[k]; !exists {
+			li = append(li, k)
+		}
+	}
 	return li
 }
 
@@ -289,7 +420,7 @@ func (v *VM) GetVariables() map[string]Variable {
 		}
 	}
 	if v.coordinator != nil {
-		globals := v.coordinator.GetVariables()
+		globals := v.coordinator.visibleGlobals(v)
 		for key, value := range globals {
 			varlist[key] = Variable{
 				Value: value.Value,
@@ -336,7 +467,7 @@ func (v *VM) GetProgram() *ast.Program {
 func (v *VM) getVariable(name string) (*Variable, bool) {
 	name = strings.ToLower(name)
 	if v.coordinator != nil && strings.HasPrefix(name, ":") {
-		return v.coordinator.GetVariable(name)
+		return v.coordinator.getGlobal(v, name)
 	}
 	val, exists := v.variables[name]
 	return val, exists
@@ -347,16 +478,93 @@ func (v *VM) getVariable(name string) (*Variable, bool) {
 // setting variables is case-insensitive
 func (v *VM) setVariable(name string, value *Variable) error {
 	name = strings.ToLower(name)
-	v.variables[name] = value
+	v.storeLocal(name, value)
 	if v.coordinator != nil && strings.HasPrefix(name, ":") {
-		err := v.coordinator.SetVariable(name, value)
-		if err != nil {
-			return err
+		v.coordinator.setGlobal(v, name, value)
+	}
+	return nil
+}
+
+// writeVariable is used by the executed code to set variables.
+// In contrast to setVariable, the write is recorded (if enabled) and triggers watchpoints.
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) writeVariable(name string, value *Variable) error {
+	name = strings.ToLower(name)
+	old, _ := v.getVariable(name)
+	v.recordWrite(name, old, value)
+	err := v.setVariable(name, value)
+	if err != nil {
+		return err
+	}
+	return v.notifyWatchpoint(name, old, value)
+}
+
+// storeLocal stores the value for the (normalized) name in the local variables of the vm.
+// A value of nil deletes the variable.
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) storeLocal(name string, value *Variable) {
+	if value == nil {
+		delete(v.variables, name)
+	} else {
+		v.variables[name] = value
+	}
+	if v.compiled != nil {
+		if slot, exists := v.compiled.slots[name]; exists {
+			v.slots[slot] = value
+		}
+	}
+}
+
+// notifyWatchpoint calls the watchpoint-handler if the written variable is watched
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) notifyWatchpoint(name string, old *Variable, value *Variable) error {
+	if v.isWatched(name) && v.watchpointHandler != nil {
+		v.lock.Unlock()
+		continueExecution := v.watchpointHandler(v, name, old, value)
+		v.lock.Lock()
+		if !continueExecution {
+			v.pause()
+			if v.relocated {
+				return errRelocated
+			}
 		}
 	}
 	return nil
 }
 
+// isWatched returns true if there is a watchpoint for the given variable on this vm or (for globals) on the coordinator
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) isWatched(name string) bool {
+	if _, exists := v.watchpoints[name]; exists {
+		return true
+	}
+	if v.coordinator != nil && strings.HasPrefix(name, ":") {
+		return v.coordinator.isWatchedBy(v, name)
+	}
+	return false
+}
+
+// relocate moves the execution to the given line. The line will be executed next.
+// If the vm is currently paused in the middle of a line, the line is aborted.
+// If the vm is paused after completing a line, that line still counts as executed.
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) relocate(astLine int, sourceLine int) {
+	finished := v.runningLine && v.lineFinished
+	v.currentAstLine = astLine
+	v.currentSourceLine = sourceLine
+	v.currentSourceColoumn = 0
+	v.jumped = false
+	v.historyEntry = nil
+	if finished {
+		v.relocatedAfterLine = true
+		return
+	}
+	v.lineFinished = false
+	if v.runningLine {
+		v.relocated = true
+	}
+}
+
 // Terminate the vm goroutine (if running)
 func (v *VM) Terminate() {
 	v.requestState(StateTerminated)
@@ -373,11 +581,26 @@ func (v *VM) WaitForTermination() {
 // blocks until the worker picks up the request
 // called from outside go.routines
 func (v *VM) requestState(state int) {
-	v.stateRequests <- state
+	if v.synchronous {
+		v.requestStateSync(state)
+		return
+	}
+	select {
+	case v.stateRequests <- state:
+	case <-v.terminationChannel:
+		// the vm has already terminated. There is nobody left to receive the request
+	}
 }
 
 // called by the worker goroutine to receive state-change-requests
 func (v *VM) receiveState() {
+	if v.synchronous {
+		// state-changes are applied directly in synchronous mode. Only termination needs to be handled here
+		if v.state == StateTerminated {
+			panic(errKillVM)
+		}
+		return
+	}
 	select {
 	case requested := <-v.stateRequests:
 		v.changeState(requested)
@@ -401,6 +624,10 @@ func (v *VM) changeState(requested int) {
 // unocks the lock while paused
 func (v *VM) pause() {
 	v.state = StatePaused
+	// a synchronous vm can not block. RunLines() returns once the current line is completed
+	if v.synchronous {
+		return
+	}
 	for {
 		v.lock.Unlock()
 		newstate := <-v.stateRequests
@@ -422,15 +649,7 @@ func (v *VM) run() {
 		if err != nil && err != errKillVM {
 			panic(err)
 		}
-		v.state = StateTerminated
-		close(v.stateRequests)
-		close(v.terminationChannel)
-		if v.coordinatorDone != nil {
-			close(v.coordinatorDone)
-		}
-		if v.finishHandler != nil {
-			v.finishHandler(v)
-		}
+		v.finish()
 	}()
 
 	v.pause()
@@ -439,8 +658,11 @@ func (v *VM) run() {
 	// necessary because of the pesky 1-indexing of lines
 	v.currentAstLine--
 
+	// true if the permission of the coordinator has been obtained, but not used
+	hasPermission := false
+
 	for {
-		v.currentAstLine++
+		v.advanceLine()
 
 		// give other goroutines a chance to aquire the lock
 		v.lock.Unlock()
@@ -451,34 +673,107 @@ func (v *VM) run() {
 			v.currentAstLine = 1
 		}
 
-		if v.currentAstLine-1 < len(v.program.Lines) {
-			// lines are counted from 1. Compensate this when indexing the array
-			line := v.program.Lines[v.currentAstLine-1]
-			err := v.runLine(line)
-			if err != nil {
-				if v.errorHandler != nil {
-					v.lock.Unlock()
-					cont := v.errorHandler(v, err)
-					v.lock.Lock()
-					if !cont {
-						v.pause()
-					}
-				} else {
-					// no error handler. Kill VM.
-					panic(errKillVM)
-				}
+		// the permission is obtained before the line to run is chosen,
+		// because the vm could be restored from a snapshot while waiting
+		coordinated := v.coordinator != nil && v.currentAstLine-1 < len(v.program.Lines)
+		if coordinated && !hasPermission {
+			v.aquireCoordinatorPermission()
+		}
+		if !coordinated && hasPermission {
+			v.coordinatorDone <- struct{}{}
+		}
+		hasPermission = false
+
+		if !v.executeCurrentLine() {
+			if coordinated && v.yielded {
+				// the coordinator has to choose again which vm runs next (see History.StepBack())
+				v.coordinator.returnPermission()
+				v.coordinatorDone <- struct{}{}
+			} else {
+				// the aborted line does not use up the permission to run a line
+				hasPermission = coordinated
 			}
-		} else {
-			// nothing to to but to trigger a line-change notification
-			v.currentSourceLine = v.currentAstLine
-			v.currentSourceColoumn = 0
-			v.sourceLineChanged()
+			v.yielded = false
+			continue
 		}
 
-		v.executedLines++
-		if v.maxExecutedLines > 0 && v.executedLines > v.maxExecutedLines {
-			panic(errKillVM)
+		if coordinated {
+			v.coordinatorDone <- struct{}{}
 		}
+
+		v.countExecutedLine()
+	}
+}
+
+// finish is called once the vm terminated. Closes all channels and calls the finish-handler
+func (v *VM) finish() {
+	v.state = StateTerminated
+	close(v.terminationChannel)
+	if v.coordinatorDone != nil {
+		close(v.coordinatorDone)
+	}
+	if v.finishHandler != nil {
+		v.finishHandler(v)
+	}
+}
+
+// advanceLine moves the execution to the next line
+func (v *VM) advanceLine() {
+	if v.relocatedAfterLine {
+		// the vm has already been moved to the line to run next
+		v.relocatedAfterLine = false
+	} else {
+		v.currentAstLine++
+	}
+	v.lineFinished = false
+	v.runningLine = false
+}
+
+// executeCurrentLine runs the line at currentAstLine and handles errors.
+// Returns false if the line has been aborted, because the vm has been moved to another line
+func (v *VM) executeCurrentLine() bool {
+	v.started = true
+	v.runningLine = true
+
+	if v.currentAstLine-1 < len(v.program.Lines) {
+		// lines are counted from 1. Compensate this when indexing the array
+		line := v.program.Lines[v.currentAstLine-1]
+		err := v.runLine(line)
+		if err != nil && err != errRelocated {
+			if v.errorHandler != nil {
+				v.lock.Unlock()
+				v.errorHandler(v, err)
+				v.lock.Lock()
+			}
+			switch v.errorModeFor(err) {
+			case ErrorModeHalt:
+				panic(errKillVM)
+			case ErrorModePause:
+				v.pause()
+			}
+		}
+	} else {
+		// nothing to to but to trigger a line-change notification
+		v.currentSourceLine = v.currentAstLine
+		v.currentSourceColoumn = 0
+		v.sourceLineChanged()
+	}
+
+	if v.relocated {
+		// the vm has been moved to another line. Do not count the aborted line
+		// and compensate the increment done by advanceLine
+		v.relocated = false
+		v.currentAstLine--
+		return false
+	}
+	return true
+}
+
+// countExecutedLine increments the number of executed lines and terminates the vm if the maximum has been reached
+func (v *VM) countExecutedLine() {
+	v.executedLines++
+	if v.maxExecutedLines > 0 && v.executedLines > v.maxExecutedLines {
+		panic(errKillVM)
 	}
 }
 
@@ -486,24 +781,18 @@ func (v *VM) run() {
 // advancing to a new source-line could trigger a step, a breakpoint or a state-change
 func (v *VM) sourceLineChanged() {
 
-	if v.state == StateStepping {
-		if v.stepHandler != nil {
-			v.lock.Unlock()
-			v.stepHandler(v)
-			v.lock.Lock()
+	if v.state == StateStepping || v.state == StateSteppingStatement {
+		v.stopForStep()
+		if v.relocated {
+			return
 		}
-		v.pause()
 	}
 
 	// check if we hit a breakpoint
-	if _, exists := v.breakpoints[v.currentSourceLine]; exists {
-		if v.breakpointHandler != nil {
-			v.lock.Unlock()
-			continueExecution := v.breakpointHandler(v)
-			v.lock.Lock()
-			if !continueExecution {
-				v.pause()
-			}
+	if bp, exists := v.breakpoints[v.currentSourceLine]; exists {
+		v.checkBreakpoint(bp)
+		if v.relocated {
+			return
 		}
 	}
 
@@ -511,6 +800,62 @@ func (v *VM) sourceLineChanged() {
 	v.receiveState()
 }
 
+// called before a statement is executed
+// reaching a statement can trigger a statement-step or a breakpoint at the statement's coloumn
+func (v *VM) statementReached() {
+	// the vm already stopped at this statement, because the source-line changed
+	if v.stoppedAtStatement {
+		return
+	}
+
+	if v.state == StateSteppingStatement {
+		v.stopForStep()
+		if v.relocated {
+			return
+		}
+	}
+
+	if bp, exists := v.columnBreakpoints[v.currentSourceLine][v.currentSourceColoumn]; exists {
+		v.checkBreakpoint(bp)
+	}
+}
+
+// calls the step-handler and pauses the vm
+func (v *VM) stopForStep() {
+	if v.stepHandler != nil {
+		v.lock.Unlock()
+		v.stepHandler(v)
+		v.lock.Lock()
+	}
+	v.stoppedAtStatement = true
+	v.pause()
+}
+
+// checks if the given breakpoint triggers. If so, the breakpoint-handler is called or the log-message is emitted
+func (v *VM) checkBreakpoint(bp *Breakpoint) {
+	if !v.breakpointTriggers(bp) {
+		return
+	}
+	if bp.IsLogpoint() {
+		if v.logHandler != nil {
+			message := v.interpolateLogMessage(bp.LogMessage)
+			v.lock.Unlock()
+			v.logHandler(v, message)
+			v.lock.Lock()
+		}
+		return
+	}
+	if v.breakpointHandler != nil {
+		v.lock.Unlock()
+		continueExecution := v.breakpointHandler(v)
+		v.lock.Lock()
+		if !continueExecution {
+			v.stoppedAtStatement = true
+			v.pause()
+		}
+	}
+}
+
 // check if the statement that is to be executed is on a different line then the previous one
 func (v *VM) checkSourceLineChanged(stmt ast.Statement) {
 	if stmt.Start().File == "" && (stmt.Start().Line != v.currentSourceLine || v.jumped) {
@@ -540,12 +885,9 @@ func (v *VM) aquireCoordinatorPermission() {
 }
 
 func (v *VM) runLine(line *ast.Line) error {
-	if v.coordinator != nil {
-		v.aquireCoordinatorPermission()
-		// no metter what happens. If we run coordinated, report done to coordinator on return
-		defer func() {
-			v.coordinatorDone <- struct{}{}
-		}()
+	v.beginHistoryEntry(line.Start().Line)
+	if v.profile != nil {
+		v.profile.lineStarted(v, v.currentAstLine)
 	}
 
 	// an empty line has no statements that would trigger actions like breakpoints
@@ -554,18 +896,21 @@ func (v *VM) runLine(line *ast.Line) error {
 		v.currentSourceLine = line.Start().Line
 		v.currentSourceColoumn = 0
 		v.sourceLineChanged()
+		if v.relocated {
+			return errRelocated
+		}
 	}
 
-	for _, stmt := range line.Statements {
-		err := v.runStmt(stmt)
-		if err != nil {
-			//errAbortLine is returned when the line is aborted due to an if. It is not really an 'error'
-			if err != errAbortLine {
-				return err
-			}
-			break
-		}
+	err := v.runLineStatements(line)
+	if err == errRelocated {
+		return err
+	}
+	//errAbortLine is returned when the line is aborted due to an if. It is not really an 'error'
+	if err != nil && err != errAbortLine {
+		v.finishLine(err)
+		return err
 	}
+	v.finishLine(nil)
 
 	if v.lineExecutedHandler != nil {
 		v.lock.Unlock()
@@ -579,9 +924,59 @@ func (v *VM) runLine(line *ast.Line) error {
 	return nil
 }
 
-func (v *VM) runStmt(stmt ast.Statement) error {
+// runs the statements of the given line using the selected engine
+func (v *VM) runLineStatements(line *ast.Line) error {
+	if v.compiled != nil {
+		for _, stmt := range v.compiled.lines[v.currentAstLine-1] {
+			err := stmt(v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, stmt := range line.Statements {
+		err := v.runStmt(stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// called once all statements of the current line have been run. err is the error that aborted the line (if any)
+func (v *VM) finishLine(err error) {
+	v.lineFinished = true
+	v.finishedAstLine = v.currentAstLine
+	v.finishHistoryEntry(err)
+}
+
+// enterStmt is called before a statement is executed. It updates the current position
+// and triggers steps and breakpoints. Returns errRelocated if the execution has been moved to another line.
+func (v *VM) enterStmt(stmt ast.Statement) error {
 	v.currentSourceColoumn = stmt.Start().Coloumn
+	v.stoppedAtStatement = false
+	if v.profile != nil {
+		v.profile.statementEntered(v, stmt.Start())
+	}
 	v.checkSourceLineChanged(stmt)
+	if v.relocated {
+		return errRelocated
+	}
+	if stmt.Start().File == "" {
+		v.statementReached()
+		if v.relocated {
+			return errRelocated
+		}
+	}
+	return nil
+}
+
+func (v *VM) runStmt(stmt ast.Statement) error {
+	err := v.enterStmt(stmt)
+	if err != nil {
+		return err
+	}
 	switch e := stmt.(type) {
 	case *ast.Assignment:
 		return v.runAssignment(e)
@@ -590,10 +985,12 @@ func (v *VM) runStmt(stmt ast.Statement) error {
 		if err != nil {
 			return err
 		}
-		if !conditionResult.IsNumber() {
-			return RuntimeError{fmt.Errorf("If-condition can not be a string"), stmt}
+		condition, err := checkCondition(e, conditionResult)
+		if err != nil {
+			return err
 		}
-		if conditionResult.Number() != number.Zero {
+		v.countBranch(e, condition)
+		if condition {
 			for _, st := range e.IfBlock {
 				err := v.runStmt(st)
 				if err != nil {
@@ -612,30 +1009,77 @@ func (v *VM) runStmt(stmt ast.Statement) error {
 	case *ast.GoToStatement:
 		line, err := v.runExpr(e.Line)
 		if err != nil {
-			return RuntimeError{err, stmt}
+			if _, isRuntimeErr := err.(RuntimeError); isRuntimeErr {
+				return err
+			}
+			return RuntimeError{
+				Base: err,
+				Node: stmt,
+				Kind: ErrKindOther,
+			}
 		}
-		if !line.IsNumber() {
-			return RuntimeError{fmt.Errorf("Can not goto a string (%s)", line.String()), e}
+		return v.gotoLine(e, line)
+	case *ast.Dereference:
+		_, err := v.runDeref(e)
+		return err
+	default:
+		return RuntimeError{
+			Base: fmt.Errorf("UNKNWON-STATEMENT:%T", e),
+			Node: stmt,
+			Kind: ErrKindOther,
 		}
-		linenr := line.Number().Int()
+	}
+}
 
-		if linenr < 1 {
-			linenr = 1
+// checkCondition checks the result of the condition of an if-statement.
+// Returns true if the if-block should be executed
+func checkCondition(stmt *ast.IfStatement, conditionResult *Variable) (bool, error) {
+	if !conditionResult.IsNumber() {
+		return false, RuntimeError{
+			Base:     fmt.Errorf("If-condition can not be a string"),
+			Node:     stmt,
+			Kind:     ErrKindStringCondition,
+			Operands: []*Variable{conditionResult},
 		}
-		if linenr > 20 {
-			linenr = 20
+	}
+	return conditionResult.Number() != number.Zero, nil
+}
+
+// gotoLine moves the execution to the line given by the evaluated target of a goto
+// Returns errAbortLine if the jump succeeded
+func (v *VM) gotoLine(stmt *ast.GoToStatement, line *Variable) error {
+	if !line.IsNumber() {
+		return RuntimeError{
+			Base:     fmt.Errorf("Can not goto a string (%s)", line.String()),
+			Node:     stmt,
+			Kind:     ErrKindStringGoto,
+			Operands: []*Variable{line},
 		}
+	}
+	linenr := line.Number().Int()
 
-		// goto one line before the actual target. After the jump, currentAstLine will be incremented and then match the target
-		v.currentAstLine = int(linenr) - 1
-		v.jumped = true
-		return errAbortLine
-	case *ast.Dereference:
-		_, err := v.runDeref(e)
-		return err
-	default:
-		return RuntimeError{fmt.Errorf("UNKNWON-STATEMENT:%T", e), stmt}
+	if linenr < 1 {
+		linenr = 1
+	}
+	if linenr > 20 {
+		linenr = 20
+	}
+
+	if v.historyEntry != nil {
+		v.historyEntry.JumpTarget = int(linenr)
 	}
+	if v.profile != nil {
+		now := time.Duration(0)
+		if v.coordinator != nil {
+			now = v.coordinator.Now()
+		}
+		v.profile.jumped(v, v.currentAstLine, int(linenr), v.executedLines, now)
+	}
+
+	// goto one line before the actual target. After the jump, currentAstLine will be incremented and then match the target
+	v.currentAstLine = int(linenr) - 1
+	v.jumped = true
+	return errAbortLine
 }
 
 func (v *VM) runAssignment(as *ast.Assignment) error {
@@ -657,8 +1101,7 @@ func (v *VM) runAssignment(as *ast.Assignment) error {
 	if err != nil {
 		return err
 	}
-	v.setVariable(as.Variable, newValue)
-	return nil
+	return v.writeVariable(as.Variable, newValue)
 }
 
 func (v *VM) runExpr(expr ast.Expression) (*Variable, error) {
@@ -678,7 +1121,11 @@ func (v *VM) runExpr(expr ast.Expression) (*Variable, error) {
 	case *ast.Dereference:
 		return v.runDeref(e)
 	default:
-		return nil, RuntimeError{fmt.Errorf("UNKNWON-EXPRESSION:%T", e), expr}
+		return nil, RuntimeError{
+			Base: fmt.Errorf("UNKNWON-EXPRESSION:%T", e),
+			Node: expr,
+			Kind: ErrKindOther,
+		}
 	}
 }
 
@@ -690,11 +1137,28 @@ func (v *VM) runDeref(d *ast.Dereference) (*Variable, error) {
 			number.Zero,
 		}
 	}
+	if d.Operator == "" {
+		return oldval, nil
+	}
+	newval, err := applyDerefOperator(d, oldval)
+	if err != nil {
+		return nil, err
+	}
+	err = v.writeVariable(d.Variable, newval)
+	if err != nil {
+		return nil, err
+	}
+	if d.PrePost == "Pre" {
+		return newval, nil
+	}
+	return oldval, nil
+}
+
+// applyDerefOperator computes the new value of a variable when applying the ++ or -- operator of the dereference
+func applyDerefOperator(d *ast.Dereference, oldval *Variable) (*Variable, error) {
 	var newval Variable
 	if oldval.IsNumber() {
 		switch d.Operator {
-		case "":
-			return oldval, nil
 		case "++":
 			newval.Value = oldval.Number().Add(number.One)
 			break
@@ -702,32 +1166,40 @@ func (v *VM) runDeref(d *ast.Dereference) (*Variable, error) {
 			newval.Value = oldval.Number().Sub(number.One)
 			break
 		default:
-			return nil, RuntimeError{fmt.Errorf("Unknown operator '%s'", d.Operator), d}
+			return nil, RuntimeError{
+				Base:     fmt.Errorf("Unknown operator '%s'", d.Operator),
+				Node:     d,
+				Kind:     ErrKindOther,
+				Operands: []*Variable{oldval},
+			}
 		}
-		v.setVariable(d.Variable, &newval)
 	}
 	if oldval.IsString() {
 		switch d.Operator {
-		case "":
-			return oldval, nil
 		case "++":
 			newval.Value = oldval.String() + " "
 			break
 		case "--":
 			if len(oldval.String()) == 0 {
-				return nil, RuntimeError{fmt.Errorf("String in variable '%s' is already empty", d.Variable), d}
+				return nil, RuntimeError{
+					Base:     fmt.Errorf("String in variable '%s' is already empty", d.Variable),
+					Node:     d,
+					Kind:     ErrKindEmptyString,
+					Operands: []*Variable{oldval},
+				}
 			}
 			newval.Value = string([]rune(oldval.String())[:len(oldval.String())-1])
 			break
 		default:
-			return nil, RuntimeError{fmt.Errorf("Unknown operator '%s'", d.Operator), d}
+			return nil, RuntimeError{
+				Base:     fmt.Errorf("Unknown operator '%s'", d.Operator),
+				Node:     d,
+				Kind:     ErrKindOther,
+				Operands: []*Variable{oldval},
+			}
 		}
-		v.setVariable(d.Variable, &newval)
 	}
-	if d.PrePost == "Pre" {
-		return &newval, nil
-	}
-	return oldval, nil
+	return &newval, nil
 }
 
 func (v *VM) runBinOp(op *ast.BinaryOperation) (*Variable, error) {
@@ -741,11 +1213,27 @@ func (v *VM) runBinOp(op *ast.BinaryOperation) (*Variable, error) {
 	}
 	result, err := RunBinaryOperation(arg1, arg2, op.Operator)
 	if err != nil {
-		return nil, RuntimeError{err, op}
+		return nil, binaryOperationError(op, arg1, arg2, err)
 	}
 	return result, err
 }
 
+// binaryOperationError wraps an error returned by a binary operation into a RuntimeError
+func binaryOperationError(op *ast.BinaryOperation, arg1 *Variable, arg2 *Variable, err error) error {
+	kind := ErrKindOther
+	if err == number.ErrDivisionByZero {
+		kind = ErrKindDivisionByZero
+	} else if arg1.IsString() || arg2.IsString() {
+		kind = ErrKindTypeMismatch
+	}
+	return RuntimeError{
+		Base:     err,
+		Node:     op,
+		Kind:     kind,
+		Operands: []*Variable{arg1, arg2},
+	}
+}
+
 func (v *VM) runUnaryOp(op *ast.UnaryOperation) (*Variable, error) {
 	arg, err := v.runExpr(op.Exp)
 	if err != nil {
@@ -754,7 +1242,21 @@ func (v *VM) runUnaryOp(op *ast.UnaryOperation) (*Variable, error) {
 
 	result, err := RunUnaryOperation(arg, op.Operator)
 	if err != nil {
-		return nil, RuntimeError{err, op}
+		return nil, unaryOperationError(op, arg, err)
 	}
 	return result, err
 }
+
+// unaryOperationError wraps an error returned by a unary operation into a RuntimeError
+func unaryOperationError(op *ast.UnaryOperation, arg *Variable, err error) error {
+	kind := ErrKindOther
+	if arg.IsString() {
+		kind = ErrKindTypeMismatch
+	}
+	return RuntimeError{
+		Base:     err,
+		Node:     op,
+		Kind:     kind,
+		Operands: []*Variable{arg},
+	}
+}
@@ -1,9 +1,11 @@
 package vm_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/dbaumgarten/yodk/pkg/testdata"
+	"github.com/dbaumgarten/yodk/pkg/vm"
 )
 
 func TestOperators(t *testing.T) {
@@ -12,3 +14,55 @@ func TestOperators(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRuntimeErrorKinds(t *testing.T) {
+	prog := `a = 1/0
+if "x" then b = 1 end
+e = "abc" goto e
+c = "a" * 2
+d = "" d--
+f = 1`
+	v, err := vm.CreateFromSource(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make([]vm.RuntimeError, 0)
+	v.SetErrorHandler(func(x *vm.VM, err error) {
+		errs = append(errs, err.(vm.RuntimeError))
+	})
+	v.SetErrorMode(vm.ErrorModeAbortLine)
+	done := make(chan struct{})
+	v.SetLineExecutedHandler(func(x *vm.VM) bool {
+		if x.CurrentSourceLine() == 6 {
+			close(done)
+			return false
+		}
+		return true
+	})
+	v.Resume()
+	<-done
+	v.Terminate()
+
+	expected := []struct {
+		kind     string
+		operands string
+	}{
+		{vm.ErrKindDivisionByZero, "1 0"},
+		{vm.ErrKindStringCondition, `"x"`},
+		{vm.ErrKindStringGoto, `"abc"`},
+		{vm.ErrKindTypeMismatch, `"a" 2`},
+		{vm.ErrKindEmptyString, `""`},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, but got %d", len(expected), len(errs))
+	}
+	for i, exp := range expected {
+		operands := make([]string, len(errs[i].Operands))
+		for j, op := range errs[i].Operands {
+			operands[j] = op.Repr()
+		}
+		if errs[i].Kind != exp.kind || strings.Join(operands, " ") != exp.operands {
+			t.Fatalf("Wrong error %d. Wanted %s with operands %s, but got %s with operands %s", i, exp.kind, exp.operands, errs[i].Kind, strings.Join(operands, " "))
+		}
+	}
+}
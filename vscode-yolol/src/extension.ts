@@ -193,8 +193,11 @@ export function activate(lcontext: ExtensionContext) {
 
 
 
+	context.subscriptions.push(vscode.commands.registerCommand('yodk.stepStatement', stepStatementCommandHandler));
+
 	context.subscriptions.push(vscode.debug.registerDebugAdapterDescriptorFactory('yodk', new DebugAdapterExecutableFactory()));
 	context.subscriptions.push(vscode.debug.registerDebugConfigurationProvider('yodk', new YodkDebugConfigurationProvider()));
+	context.subscriptions.push(vscode.debug.registerDebugAdapterTrackerFactory('yodk', new StoppedThreadTrackerFactory()));
 
 	startLangServer()
 }
@@ -206,6 +209,38 @@ export function deactivate(): Thenable<void> | undefined {
 	return client.stop();
 }
 
+// the id of the thread that stopped most recently, for every debug-session
+let stoppedThreads = new Map<string, number>()
+
+// steps the most recently stopped thread of the active debug-session by one statement
+function stepStatementCommandHandler() {
+	const session = vscode.debug.activeDebugSession
+	if (!session || session.type != "yodk" || !stoppedThreads.has(session.id)) {
+		vscode.window.showErrorMessage("There is no paused yodk debug-session")
+		return
+	}
+	session.customRequest("next", {
+		threadId: stoppedThreads.get(session.id),
+		granularity: "statement"
+	})
+}
+
+// keeps track of the thread that stopped most recently
+export class StoppedThreadTrackerFactory implements vscode.DebugAdapterTrackerFactory {
+	createDebugAdapterTracker(session: vscode.DebugSession): ProviderResult<vscode.DebugAdapterTracker> {
+		return {
+			onDidSendMessage: (message) => {
+				if (message.type == "event" && message.event == "stopped" && message.body.threadId) {
+					stoppedThreads.set(session.id, message.body.threadId)
+				}
+			},
+			onWillStopSession: () => {
+				stoppedThreads.delete(session.id)
+			}
+		}
+	}
+}
+
 export class DebugAdapterExecutableFactory implements vscode.DebugAdapterDescriptorFactory {
 	createDebugAdapterDescriptor(_session: vscode.DebugSession, executable: vscode.DebugAdapterExecutable | undefined): ProviderResult<vscode.DebugAdapterDescriptor> {
 		